@@ -0,0 +1,192 @@
+package lib
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/organizations"
+	orgtypes "github.com/aws/aws-sdk-go-v2/service/organizations/types"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+)
+
+// session name of the assumed roles, shows in the target accounts CloudTrail
+const AccountRoleSession = "ec2scheduler"
+
+// accounts scheduled at once, 40 accounts times every region is a lot of goroutines and API calls
+const maxConcurrentAccounts = 10
+
+var accountIDPattern = regexp.MustCompile(`^\d{12}$`)
+
+// where the target accounts come from (ids, an SSM parameter, OUs) and the role assumed in them
+// the sources are combined and deduplicated, none is the Lambda account with its own credentials
+type AccountConfig struct {
+	// account ids or role Arns, comma separated
+	Accounts string `env:"ACCOUNTS"`
+	// SSM parameter (String or StringList) holding account ids or role Arns, comma separated
+	AccountsParameter string `env:"ACCOUNTS_PARAMETER"`
+	// AWS Organizations OUs (or root) whose active accounts are targeted, comma separated
+	// only the accounts directly in the OU, not in its child OUs
+	AccountsOU string `env:"ACCOUNTS_OU"`
+	// role assumed in the accounts given by id
+	AccountRole string `env:"ACCOUNT_ROLE" envDefault:"ec2scheduler"`
+}
+
+// Account to schedule instances in, through its role
+// no RoleARN is the Lambda account, its credentials are used as they are
+type Account struct {
+	ID      string
+	RoleARN string
+}
+
+// Organizations call to list the accounts of an OU, *organizations.Client implements it
+type OrganizationsAPI interface {
+	organizations.ListAccountsForParentAPIClient
+}
+
+// accounts of the AccountConfig sources, the Lambda account if none is set
+// ssmClient and orgClient are only called when their source is set
+func ParseAccounts(ctx context.Context, conf AccountConfig, ssmClient SSMClientAPI, orgClient OrganizationsAPI) ([]Account, error) {
+	entries := splitList(conf.Accounts)
+
+	if conf.AccountsParameter != "" {
+		resp, err := ssmClient.GetParameter(ctx, &ssm.GetParameterInput{
+			Name:           aws.String(conf.AccountsParameter),
+			WithDecryption: true,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("unable to read accounts parameter %s: %w", conf.AccountsParameter, err)
+		}
+		entries = append(entries, splitList(aws.ToString(resp.Parameter.Value))...)
+	}
+
+	for _, ou := range splitList(conf.AccountsOU) {
+		ids, err := listOUAccounts(ctx, orgClient, ou)
+		if err != nil {
+			return nil, fmt.Errorf("unable to list accounts of %s: %w", ou, err)
+		}
+		entries = append(entries, ids...)
+	}
+
+	if len(entries) == 0 {
+		// an empty OU or parameter mustn't fall back to the Lambda account
+		if conf.Accounts != "" || conf.AccountsParameter != "" || conf.AccountsOU != "" {
+			return nil, fmt.Errorf("no account found in the configured accounts")
+		}
+		return []Account{{}}, nil
+	}
+
+	accounts := []Account{}
+	seen := map[string]bool{}
+	for _, entry := range entries {
+		account, err := parseAccount(entry, conf.AccountRole)
+		if err != nil {
+			return nil, err
+		}
+		if seen[account.ID] {
+			continue
+		}
+
+		seen[account.ID] = true
+		accounts = append(accounts, account)
+	}
+
+	return accounts, nil
+}
+
+// account of an account id (assuming role) or a role Arn
+func parseAccount(entry, role string) (Account, error) {
+	if accountIDPattern.MatchString(entry) {
+		return Account{ID: entry, RoleARN: fmt.Sprintf("arn:aws:iam::%s:role/%s", entry, role)}, nil
+	}
+
+	// arn:<partition>:iam::<account>:role/<name>
+	parts := strings.SplitN(entry, ":", 6)
+	if len(parts) == 6 && parts[0] == "arn" && parts[2] == "iam" && accountIDPattern.MatchString(parts[4]) && strings.HasPrefix(parts[5], "role/") {
+		return Account{ID: parts[4], RoleARN: entry}, nil
+	}
+
+	return Account{}, fmt.Errorf("invalid account %s, expected an account id or a role Arn", entry)
+}
+
+// ids of the active accounts directly in ou, following NextToken
+func listOUAccounts(ctx context.Context, client OrganizationsAPI, ou string) ([]string, error) {
+	ids := []string{}
+	paginator := organizations.NewListAccountsForParentPaginator(client, &organizations.ListAccountsForParentInput{
+		ParentId: aws.String(ou),
+	})
+	for paginator.HasMorePages() {
+		resp, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, account := range resp.Accounts {
+			if account.Status == orgtypes.AccountStatusActive {
+				ids = append(ids, aws.ToString(account.Id))
+			}
+		}
+	}
+
+	return ids, nil
+}
+
+// comma separated values, blanks left out
+func splitList(value string) []string {
+	values := []string{}
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+
+	return values
+}
+
+// cfg with the credentials of the account role, assumed with stsClient and renewed once expired
+// cfg itself for the Lambda account
+func AccountAWSConfig(cfg aws.Config, stsClient stscreds.AssumeRoleAPIClient, account Account) aws.Config {
+	if account.RoleARN == "" {
+		return cfg
+	}
+
+	accountCfg := cfg.Copy()
+	accountCfg.Credentials = aws.NewCredentialsCache(stscreds.NewAssumeRoleProvider(stsClient, account.RoleARN, func(o *stscreds.AssumeRoleOptions) {
+		o.RoleSessionName = AccountRoleSession
+	}))
+
+	return accountCfg
+}
+
+// run fn for every account concurrently, at most maxConcurrentAccounts at once
+// an account failing doesn't affect the others, return the errors by account id
+func ForEachAccount(ctx context.Context, accounts []Account, fn func(ctx context.Context, account Account) error) map[string]error {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	errs := map[string]error{}
+	slots := make(chan struct{}, maxConcurrentAccounts)
+
+	for _, account := range accounts {
+		wg.Add(1)
+		go func(account Account) {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+
+			if err := fn(ctx, account); err != nil {
+				log.Printf("[%s] %s", account.ID, err)
+				mu.Lock()
+				errs[account.ID] = err
+				mu.Unlock()
+			}
+		}(account)
+	}
+	wg.Wait()
+
+	return errs
+}
@@ -0,0 +1,189 @@
+package lib
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/organizations"
+	orgtypes "github.com/aws/aws-sdk-go-v2/service/organizations/types"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	ststypes "github.com/aws/aws-sdk-go-v2/service/sts/types"
+	"github.com/stretchr/testify/assert"
+)
+
+var _ OrganizationsAPI = (*mockOrganizationsClient)(nil)
+var _ stscreds.AssumeRoleAPIClient = (*mockSTSclient)(nil)
+
+type mockOrganizationsClient struct {
+	// ListAccountsForParent pages by OU, NextToken is the index of the next page
+	accounts map[string][][]orgtypes.Account
+}
+
+func (m *mockOrganizationsClient) ListAccountsForParent(ctx context.Context, params *organizations.ListAccountsForParentInput, optFns ...func(*organizations.Options)) (*organizations.ListAccountsForParentOutput, error) {
+	pages, ok := m.accounts[*params.ParentId]
+	if !ok {
+		return nil, fmt.Errorf("ParentNotFoundException")
+	}
+
+	page := 0
+	if params.NextToken != nil {
+		fmt.Sscan(*params.NextToken, &page)
+	}
+
+	resp := &organizations.ListAccountsForParentOutput{Accounts: pages[page]}
+	if page+1 < len(pages) {
+		resp.NextToken = aws.String(fmt.Sprint(page + 1))
+	}
+	return resp, nil
+}
+
+type mockSTSclient struct {
+	mu    sync.Mutex
+	roles []string
+}
+
+func (m *mockSTSclient) AssumeRole(ctx context.Context, params *sts.AssumeRoleInput, optFns ...func(*sts.Options)) (*sts.AssumeRoleOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.roles = append(m.roles, *params.RoleArn)
+
+	return &sts.AssumeRoleOutput{
+		Credentials: &ststypes.Credentials{
+			AccessKeyId:     aws.String("AKID-" + *params.RoleArn),
+			SecretAccessKey: aws.String("secret"),
+			SessionToken:    aws.String("token"),
+			Expiration:      aws.Time(time.Now().Add(time.Hour)),
+		},
+	}, nil
+}
+
+func orgAccount(id string, status orgtypes.AccountStatus) orgtypes.Account {
+	return orgtypes.Account{Id: aws.String(id), Status: status}
+}
+
+func TestParseAccounts(t *testing.T) {
+	ssmClient := &mockSSMclient{parameters: map[string]string{
+		"/ec2scheduler/accounts": "222222222222,arn:aws:iam::333333333333:role/scheduler",
+		"/ec2scheduler/empty":    " ",
+	}}
+	orgClient := &mockOrganizationsClient{accounts: map[string][][]orgtypes.Account{
+		"ou-ab12-dev": {
+			{orgAccount("444444444444", orgtypes.AccountStatusActive), orgAccount("555555555555", orgtypes.AccountStatusSuspended)},
+			{orgAccount("666666666666", orgtypes.AccountStatusActive), orgAccount("111111111111", orgtypes.AccountStatusActive)},
+		},
+		"ou-ab12-empty": {{orgAccount("777777777777", orgtypes.AccountStatusSuspended)}},
+	}}
+
+	tests := []struct {
+		name string
+		conf AccountConfig
+		want []Account
+		err  bool
+	}{
+		{
+			name: "Lambda account",
+			conf: AccountConfig{AccountRole: "ec2scheduler"},
+			want: []Account{{}},
+		},
+		{
+			name: "every source",
+			conf: AccountConfig{
+				Accounts:          "111111111111",
+				AccountsParameter: "/ec2scheduler/accounts",
+				AccountsOU:        "ou-ab12-dev",
+				AccountRole:       "ec2scheduler",
+			},
+			want: []Account{
+				{ID: "111111111111", RoleARN: "arn:aws:iam::111111111111:role/ec2scheduler"},
+				{ID: "222222222222", RoleARN: "arn:aws:iam::222222222222:role/ec2scheduler"},
+				{ID: "333333333333", RoleARN: "arn:aws:iam::333333333333:role/scheduler"},
+				{ID: "444444444444", RoleARN: "arn:aws:iam::444444444444:role/ec2scheduler"},
+				{ID: "666666666666", RoleARN: "arn:aws:iam::666666666666:role/ec2scheduler"},
+			},
+		},
+		{
+			name: "invalid account",
+			conf: AccountConfig{Accounts: "dev", AccountRole: "ec2scheduler"},
+			err:  true,
+		},
+		{
+			name: "unknown parameter",
+			conf: AccountConfig{AccountsParameter: "/unknown", AccountRole: "ec2scheduler"},
+			err:  true,
+		},
+		{
+			name: "empty OU",
+			conf: AccountConfig{AccountsOU: "ou-ab12-empty", AccountRole: "ec2scheduler"},
+			err:  true,
+		},
+		{
+			name: "empty parameter",
+			conf: AccountConfig{AccountsParameter: "/ec2scheduler/empty", AccountRole: "ec2scheduler"},
+			err:  true,
+		},
+		{
+			name: "unknown OU",
+			conf: AccountConfig{AccountsOU: "ou-unknown", AccountRole: "ec2scheduler"},
+			err:  true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := ParseAccounts(context.Background(), test.conf, ssmClient, orgClient)
+			if test.err {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, test.want, got)
+		})
+	}
+}
+
+func TestAccountAWSConfig(t *testing.T) {
+	cfg := aws.Config{Region: "eu-west-1", Credentials: aws.AnonymousCredentials{}}
+	stsClient := &mockSTSclient{}
+
+	// Lambda account, credentials left as they are
+	assert.Equal(t, cfg, AccountAWSConfig(cfg, stsClient, Account{}))
+
+	account := Account{ID: "111111111111", RoleARN: "arn:aws:iam::111111111111:role/ec2scheduler"}
+	accountCfg := AccountAWSConfig(cfg, stsClient, account)
+	assert.Equal(t, "eu-west-1", accountCfg.Region)
+
+	// the role is assumed once, its credentials cached until they expire
+	for i := 0; i < 2; i++ {
+		creds, err := accountCfg.Credentials.Retrieve(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, "AKID-"+account.RoleARN, creds.AccessKeyID)
+	}
+	assert.Equal(t, []string{account.RoleARN}, stsClient.roles)
+	assert.Equal(t, aws.AnonymousCredentials{}, cfg.Credentials)
+}
+
+func TestForEachAccount(t *testing.T) {
+	var mu sync.Mutex
+	done := []string{}
+
+	accounts := []Account{{ID: "111111111111"}, {ID: "222222222222"}, {ID: "333333333333"}}
+	errs := ForEachAccount(context.Background(), accounts, func(ctx context.Context, account Account) error {
+		if account.ID == "222222222222" {
+			return fmt.Errorf("AccessDenied")
+		}
+
+		mu.Lock()
+		done = append(done, account.ID)
+		mu.Unlock()
+		return nil
+	})
+
+	assert.ElementsMatch(t, []string{"111111111111", "333333333333"}, done)
+	assert.Equal(t, map[string]error{"222222222222": fmt.Errorf("AccessDenied")}, errs)
+}
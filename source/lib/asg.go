@@ -0,0 +1,208 @@
+package lib
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/autoscaling"
+	astypes "github.com/aws/aws-sdk-go-v2/service/autoscaling/types"
+)
+
+// tag AWS sets on the instances launched by an Auto Scaling group
+const AutoScalingGroupTag = "aws:autoscaling:groupName"
+
+// Auto Scaling calls of the group driver, *autoscaling.Client implements it
+type AutoScalingAPI interface {
+	autoscaling.DescribeAutoScalingGroupsAPIClient
+	UpdateAutoScalingGroup(ctx context.Context, params *autoscaling.UpdateAutoScalingGroupInput, optFns ...func(*autoscaling.Options)) (*autoscaling.UpdateAutoScalingGroupOutput, error)
+	CreateOrUpdateTags(ctx context.Context, params *autoscaling.CreateOrUpdateTagsInput, optFns ...func(*autoscaling.Options)) (*autoscaling.CreateOrUpdateTagsOutput, error)
+	DeleteTags(ctx context.Context, params *autoscaling.DeleteTagsInput, optFns ...func(*autoscaling.Options)) (*autoscaling.DeleteTagsOutput, error)
+}
+
+// min/max/desired capacity of a group, saved in the capacity tag while it is scaled to zero
+type groupCapacity struct {
+	min     int32
+	max     int32
+	desired int32
+}
+
+func (c groupCapacity) String() string {
+	return fmt.Sprintf("min=%d,max=%d,desired=%d", c.min, c.max, c.desired)
+}
+
+func parseGroupCapacity(value string) (groupCapacity, error) {
+	c := groupCapacity{}
+	if _, err := fmt.Sscanf(value, "min=%d,max=%d,desired=%d", &c.min, &c.max, &c.desired); err != nil {
+		return c, fmt.Errorf("%w %s, expected min=1,max=4,desired=2", errInvalidCapacity, value)
+	}
+
+	return c, nil
+}
+
+// AutoScalingDriver schedules the Auto Scaling groups of a region, scaling them to zero and back
+// a group is running while its desired capacity isn't zero
+type AutoScalingDriver struct {
+	client AutoScalingAPI
+	region string
+	// tag saving the capacity of a group scaled to zero (scheduleTagCapacity)
+	capacityTag string
+}
+
+func NewAutoScalingDriver(client AutoScalingAPI, region, capacityTag string) *AutoScalingDriver {
+	return &AutoScalingDriver{client: client, region: region, capacityTag: capacityTag}
+}
+
+func (d *AutoScalingDriver) Types() []string {
+	return []string{ResourceTypeAutoScalingGroup}
+}
+
+// DescribeAutoScalingGroups can't filter on tags, every group is listed
+func (d *AutoScalingDriver) List(ctx context.Context, tagKey string) ([]Resource, error) {
+	groups, err := d.describe(ctx, &autoscaling.DescribeAutoScalingGroupsInput{})
+	if err != nil {
+		return nil, err
+	}
+
+	resources := []Resource{}
+	for _, group := range groups {
+		r := d.resource(group)
+		if _, ok := r.Tags[tagKey]; ok {
+			resources = append(resources, r)
+		}
+	}
+
+	return resources, nil
+}
+
+func (d *AutoScalingDriver) Get(ctx context.Context, resourceType, id string) (Resource, error) {
+	groups, err := d.describe(ctx, &autoscaling.DescribeAutoScalingGroupsInput{
+		AutoScalingGroupNames: []string{id},
+	})
+	if err != nil {
+		return Resource{}, err
+	}
+	if len(groups) < 1 {
+		return Resource{}, ErrNotFound
+	}
+
+	return d.resource(groups[0]), nil
+}
+
+// groups matching input, following NextToken
+func (d *AutoScalingDriver) describe(ctx context.Context, input *autoscaling.DescribeAutoScalingGroupsInput) ([]astypes.AutoScalingGroup, error) {
+	groups := []astypes.AutoScalingGroup{}
+	paginator := autoscaling.NewDescribeAutoScalingGroupsPaginator(d.client, input)
+	for paginator.HasMorePages() {
+		resp, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, resp.AutoScalingGroups...)
+	}
+
+	return groups, nil
+}
+
+func (d *AutoScalingDriver) resource(group astypes.AutoScalingGroup) Resource {
+	name := aws.ToString(group.AutoScalingGroupName)
+
+	state := StateRunning
+	if aws.ToInt32(group.DesiredCapacity) == 0 {
+		state = StateStopped
+	}
+
+	tags := map[string]string{}
+	for _, tag := range group.Tags {
+		tags[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+	}
+
+	return Resource{
+		Type:    ResourceTypeAutoScalingGroup,
+		ID:      name,
+		Name:    name,
+		ARN:     aws.ToString(group.AutoScalingGroupARN),
+		Account: arnAccount(aws.ToString(group.AutoScalingGroupARN)),
+		Region:  d.region,
+		State:   state,
+		Tags:    tags,
+	}
+}
+
+// restore the capacity saved in the capacity tag, then delete the tag
+// a group scaled to zero outside of the scheduler has nothing to restore, ErrUnchanged
+func (d *AutoScalingDriver) Start(ctx context.Context, resources []Resource) []error {
+	return startScaled(ctx, d, d.capacityTag, resources)
+}
+
+// save the group capacity in the capacity tag, then scale it to zero
+func (d *AutoScalingDriver) Stop(ctx context.Context, resources []Resource) []error {
+	return stopScaled(ctx, d, d.capacityTag, resources)
+}
+
+func (d *AutoScalingDriver) capacity(ctx context.Context, r Resource) (string, error) {
+	groups, err := d.describe(ctx, &autoscaling.DescribeAutoScalingGroupsInput{
+		AutoScalingGroupNames: []string{r.ID},
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(groups) < 1 {
+		return "", ErrNotFound
+	}
+
+	return groupCapacity{
+		min:     aws.ToInt32(groups[0].MinSize),
+		max:     aws.ToInt32(groups[0].MaxSize),
+		desired: aws.ToInt32(groups[0].DesiredCapacity),
+	}.String(), nil
+}
+
+func (d *AutoScalingDriver) scale(ctx context.Context, r Resource, saved string) error {
+	capacity := groupCapacity{}
+	if saved != "" {
+		var err error
+		if capacity, err = parseGroupCapacity(saved); err != nil {
+			return err
+		}
+	}
+
+	_, err := d.client.UpdateAutoScalingGroup(ctx, &autoscaling.UpdateAutoScalingGroupInput{
+		AutoScalingGroupName: aws.String(r.ID),
+		MinSize:              aws.Int32(capacity.min),
+		MaxSize:              aws.Int32(capacity.max),
+		DesiredCapacity:      aws.Int32(capacity.desired),
+	})
+
+	return err
+}
+
+func (d *AutoScalingDriver) CreateTags(ctx context.Context, resource Resource, tags map[string]string) error {
+	asTags := []astypes.Tag{}
+	for _, k := range sortedKeys(tags) {
+		asTags = append(asTags, astypes.Tag{
+			ResourceId:        aws.String(resource.ID),
+			ResourceType:      aws.String("auto-scaling-group"),
+			Key:               aws.String(k),
+			Value:             aws.String(tags[k]),
+			PropagateAtLaunch: aws.Bool(false),
+		})
+	}
+
+	_, err := d.client.CreateOrUpdateTags(ctx, &autoscaling.CreateOrUpdateTagsInput{Tags: asTags})
+	return err
+}
+
+func (d *AutoScalingDriver) DeleteTags(ctx context.Context, resource Resource, keys ...string) error {
+	asTags := []astypes.Tag{}
+	for _, k := range keys {
+		asTags = append(asTags, astypes.Tag{
+			ResourceId:   aws.String(resource.ID),
+			ResourceType: aws.String("auto-scaling-group"),
+			Key:          aws.String(k),
+		})
+	}
+
+	_, err := d.client.DeleteTags(ctx, &autoscaling.DeleteTagsInput{Tags: asTags})
+	return err
+}
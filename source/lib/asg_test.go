@@ -0,0 +1,147 @@
+package lib
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/autoscaling"
+	astypes "github.com/aws/aws-sdk-go-v2/service/autoscaling/types"
+	"github.com/stretchr/testify/assert"
+)
+
+var _ AutoScalingAPI = (*mockAutoScalingClient)(nil)
+var _ Driver = (*AutoScalingDriver)(nil)
+var _ capacityScaler = (*AutoScalingDriver)(nil)
+
+type mockAutoScalingClient struct {
+	err    error
+	groups []astypes.AutoScalingGroup
+
+	updates     []*autoscaling.UpdateAutoScalingGroupInput
+	tags        []astypes.Tag
+	deletedTags []astypes.Tag
+}
+
+// groups of AutoScalingGroupNames, all of them without names
+func (m *mockAutoScalingClient) DescribeAutoScalingGroups(ctx context.Context, params *autoscaling.DescribeAutoScalingGroupsInput, optFns ...func(*autoscaling.Options)) (*autoscaling.DescribeAutoScalingGroupsOutput, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+
+	groups := []astypes.AutoScalingGroup{}
+	for _, group := range m.groups {
+		if len(params.AutoScalingGroupNames) == 0 || aws.ToString(group.AutoScalingGroupName) == params.AutoScalingGroupNames[0] {
+			groups = append(groups, group)
+		}
+	}
+
+	return &autoscaling.DescribeAutoScalingGroupsOutput{AutoScalingGroups: groups}, nil
+}
+
+func (m *mockAutoScalingClient) UpdateAutoScalingGroup(ctx context.Context, params *autoscaling.UpdateAutoScalingGroupInput, optFns ...func(*autoscaling.Options)) (*autoscaling.UpdateAutoScalingGroupOutput, error) {
+	m.updates = append(m.updates, params)
+	return &autoscaling.UpdateAutoScalingGroupOutput{}, m.err
+}
+
+func (m *mockAutoScalingClient) CreateOrUpdateTags(ctx context.Context, params *autoscaling.CreateOrUpdateTagsInput, optFns ...func(*autoscaling.Options)) (*autoscaling.CreateOrUpdateTagsOutput, error) {
+	m.tags = append(m.tags, params.Tags...)
+	return &autoscaling.CreateOrUpdateTagsOutput{}, m.err
+}
+
+func (m *mockAutoScalingClient) DeleteTags(ctx context.Context, params *autoscaling.DeleteTagsInput, optFns ...func(*autoscaling.Options)) (*autoscaling.DeleteTagsOutput, error) {
+	m.deletedTags = append(m.deletedTags, params.Tags...)
+	return &autoscaling.DeleteTagsOutput{}, m.err
+}
+
+func TestParseGroupCapacity(t *testing.T) {
+	got, err := parseGroupCapacity("min=1,max=4,desired=2")
+	assert.NoError(t, err)
+	assert.Equal(t, groupCapacity{min: 1, max: 4, desired: 2}, got)
+	assert.Equal(t, "min=1,max=4,desired=2", got.String())
+
+	_, err = parseGroupCapacity("1,4,2")
+	assert.Error(t, err)
+}
+
+func TestAutoScalingDriverList(t *testing.T) {
+	d := NewAutoScalingDriver(&mockAutoScalingClient{groups: []astypes.AutoScalingGroup{
+		{
+			AutoScalingGroupName: aws.String("web"),
+			AutoScalingGroupARN:  aws.String("arn:aws:autoscaling:eu-west-1:123456789012:autoScalingGroup:uuid:autoScalingGroupName/web"),
+			MinSize:              aws.Int32(1),
+			MaxSize:              aws.Int32(4),
+			DesiredCapacity:      aws.Int32(2),
+			Tags:                 []astypes.TagDescription{{Key: aws.String("Schedule"), Value: aws.String("07:00-19:00")}},
+		},
+		{
+			AutoScalingGroupName: aws.String("batch"),
+			MinSize:              aws.Int32(0),
+			MaxSize:              aws.Int32(0),
+			DesiredCapacity:      aws.Int32(0),
+			Tags: []astypes.TagDescription{
+				{Key: aws.String("Schedule"), Value: aws.String("18:00-22:00")},
+				{Key: aws.String("ScheduleCapacity"), Value: aws.String("min=2,max=2,desired=2")},
+			},
+		},
+		{
+			AutoScalingGroupName: aws.String("unscheduled"),
+			MinSize:              aws.Int32(1),
+			MaxSize:              aws.Int32(1),
+			DesiredCapacity:      aws.Int32(1),
+		},
+	}}, "eu-west-1", "ScheduleCapacity")
+
+	got, err := d.List(context.Background(), "Schedule")
+	assert.NoError(t, err)
+	assert.Len(t, got, 2)
+	assert.Equal(t, ResourceTypeAutoScalingGroup, got[0].Type)
+	assert.Equal(t, "web", got[0].ID)
+	assert.Equal(t, "123456789012", got[0].Account)
+	assert.Equal(t, StateRunning, got[0].State)
+	assert.Equal(t, StateStopped, got[1].State)
+
+	_, err = d.Get(context.Background(), ResourceTypeAutoScalingGroup, "missing")
+	assert.Equal(t, ErrNotFound, err)
+}
+
+func TestAutoScalingDriverStartStop(t *testing.T) {
+	client := &mockAutoScalingClient{groups: []astypes.AutoScalingGroup{
+		{AutoScalingGroupName: aws.String("web"), MinSize: aws.Int32(1), MaxSize: aws.Int32(4), DesiredCapacity: aws.Int32(2)},
+	}}
+	d := NewAutoScalingDriver(client, "eu-west-1", "ScheduleCapacity")
+
+	errs := d.Stop(context.Background(), []Resource{{ID: "web"}})
+	assert.Equal(t, []error{nil}, errs)
+
+	// capacity saved before scaling to zero
+	assert.Equal(t, []astypes.Tag{
+		{
+			ResourceId:        aws.String("web"),
+			ResourceType:      aws.String("auto-scaling-group"),
+			Key:               aws.String("ScheduleCapacity"),
+			Value:             aws.String("min=1,max=4,desired=2"),
+			PropagateAtLaunch: aws.Bool(false),
+		},
+	}, client.tags)
+
+	errs = d.Start(context.Background(), []Resource{
+		{ID: "batch", Tags: map[string]string{"ScheduleCapacity": "min=2,max=2,desired=2"}},
+		// scaled to zero by hand
+		{ID: "manual", Tags: map[string]string{}},
+		{ID: "edited", Tags: map[string]string{"ScheduleCapacity": "2"}},
+	})
+	assert.Equal(t, []error{nil, ErrUnchanged, ErrUnchanged}, errs)
+	assert.Equal(t, []*autoscaling.UpdateAutoScalingGroupInput{
+		{AutoScalingGroupName: aws.String("web"), MinSize: aws.Int32(0), MaxSize: aws.Int32(0), DesiredCapacity: aws.Int32(0)},
+		{AutoScalingGroupName: aws.String("batch"), MinSize: aws.Int32(2), MaxSize: aws.Int32(2), DesiredCapacity: aws.Int32(2)},
+	}, client.updates)
+	assert.Equal(t, "ScheduleCapacity", aws.ToString(client.deletedTags[0].Key))
+
+	// not scaled to zero if the capacity can't be saved
+	client = &mockAutoScalingClient{err: fmt.Errorf("AccessDenied")}
+	errs = NewAutoScalingDriver(client, "eu-west-1", "ScheduleCapacity").Stop(context.Background(), []Resource{{ID: "web"}})
+	assert.EqualError(t, errs[0], "AccessDenied")
+	assert.Empty(t, client.updates)
+}
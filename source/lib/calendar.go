@@ -0,0 +1,269 @@
+package lib
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	ssmtypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
+)
+
+// holiday calendar, dates the instance should not run on
+type Calendar struct {
+	// 2006-01-02 -> holiday name
+	holidays map[string]string
+	// 01-02 -> holiday name, every year (RRULE:FREQ=YEARLY)
+	yearly map[string]string
+}
+
+type S3ClientAPI interface {
+	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+}
+
+type SSMClientAPI interface {
+	GetParameter(ctx context.Context, params *ssm.GetParameterInput, optFns ...func(*ssm.Options)) (*ssm.GetParameterOutput, error)
+}
+
+// SSM parameters a ScheduleCalendar tag may name, a tag can't point the functions at any other parameter
+// no SSM calendar at all if empty
+type CalendarConfig struct {
+	CalendarParameterPrefix string `env:"CALENDAR_PARAMETER_PREFIX" envDefault:"/ec2scheduler/calendars/"`
+}
+
+// holiday calendars by ScheduleCalendar reference, loaded once per run
+// safe for concurrent use, regions are scheduled concurrently
+type CalendarStore struct {
+	s3Client        S3ClientAPI
+	ssmClient       SSMClientAPI
+	parameterPrefix string
+
+	mu        sync.Mutex
+	calendars map[string]*Calendar
+	errs      map[string]error
+}
+
+func NewCalendarStore(s3Client S3ClientAPI, ssmClient SSMClientAPI, conf CalendarConfig) *CalendarStore {
+	prefix := conf.CalendarParameterPrefix
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+
+	return &CalendarStore{
+		s3Client:        s3Client,
+		ssmClient:       ssmClient,
+		parameterPrefix: prefix,
+		calendars:       map[string]*Calendar{},
+		errs:            map[string]error{},
+	}
+}
+
+// load a calendar from its reference
+// s3://bucket/key                    S3 object
+// ssm:/ec2scheduler/calendars/name   SSM String parameter, under CalendarParameterPrefix
+func (c *CalendarStore) Load(ctx context.Context, ref string) (*Calendar, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if cal, ok := c.calendars[ref]; ok {
+		return cal, nil
+	}
+	if err, ok := c.errs[ref]; ok {
+		return nil, err
+	}
+
+	data, err := c.read(ctx, ref)
+	if err == nil {
+		c.calendars[ref] = ParseCalendar(data)
+		return c.calendars[ref], nil
+	}
+
+	c.errs[ref] = err
+	return nil, err
+}
+
+func (c *CalendarStore) read(ctx context.Context, ref string) (string, error) {
+	switch {
+	case strings.HasPrefix(ref, "s3://"):
+		bucketKey := strings.SplitN(strings.TrimPrefix(ref, "s3://"), "/", 2)
+		if len(bucketKey) != 2 {
+			return "", fmt.Errorf("invalid S3 calendar %s, expected s3://bucket/key", ref)
+		}
+
+		resp, err := c.s3Client.GetObject(ctx, &s3.GetObjectInput{
+			Bucket: aws.String(bucketKey[0]),
+			Key:    aws.String(bucketKey[1]),
+		})
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+
+		data, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return "", err
+		}
+		return string(data), nil
+
+	case strings.HasPrefix(ref, "ssm:"):
+		name := strings.TrimPrefix(ref, "ssm:")
+		if c.parameterPrefix == "" {
+			return "", fmt.Errorf("invalid SSM calendar %s, SSM calendars are not enabled", ref)
+		}
+		if !strings.HasPrefix(name, c.parameterPrefix) {
+			return "", fmt.Errorf("invalid SSM calendar %s, expected a parameter under %s", ref, c.parameterPrefix)
+		}
+
+		// SecureString parameters are not decrypted, a tag can't read a secret
+		resp, err := c.ssmClient.GetParameter(ctx, &ssm.GetParameterInput{
+			Name: aws.String(name),
+		})
+		if err != nil {
+			return "", err
+		}
+		if resp.Parameter.Type == ssmtypes.ParameterTypeSecureString {
+			return "", fmt.Errorf("invalid SSM calendar %s, SecureString parameters are not supported", ref)
+		}
+		return aws.ToString(resp.Parameter.Value), nil
+	}
+
+	return "", fmt.Errorf("invalid calendar %s, expected s3://bucket/key or ssm:/parameter", ref)
+}
+
+// parse an iCalendar (.ics) or a list of dates, one per line
+// 2021-12-24 Christmas Eve
+// 20211225 Christmas Day
+// # comment
+func ParseCalendar(data string) *Calendar {
+	if strings.Contains(data, "BEGIN:VCALENDAR") {
+		return parseICS(data)
+	}
+
+	c := &Calendar{holidays: map[string]string{}, yearly: map[string]string{}}
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+
+		for _, layout := range []string{"2006-01-02", "20060102"} {
+			if d, err := time.Parse(layout, fields[0]); err == nil {
+				c.holidays[d.Format("2006-01-02")] = strings.Join(fields[1:], " ")
+				break
+			}
+		}
+	}
+
+	return c
+}
+
+var icsUnescape = strings.NewReplacer(`\,`, ",", `\;`, ";", `\n`, " ", `\\`, `\`)
+
+// parse all-day and timed VEVENTs of an iCalendar, yearly recurrences included
+func parseICS(data string) *Calendar {
+	c := &Calendar{holidays: map[string]string{}, yearly: map[string]string{}}
+
+	// unfold lines, a line starting with a space continues the previous one
+	lines := []string{}
+	for _, line := range strings.Split(strings.Replace(data, "\r\n", "\n", -1), "\n") {
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+
+	var start, end time.Time
+	var endExclusive, yearly bool
+	var summary string
+	for _, line := range lines {
+		// NAME;PARAM=VALUE:value
+		nameValue := strings.SplitN(line, ":", 2)
+		if len(nameValue) != 2 {
+			continue
+		}
+		name := strings.SplitN(nameValue[0], ";", 2)[0]
+		value := strings.TrimSpace(nameValue[1])
+
+		switch name {
+		case "BEGIN":
+			if value == "VEVENT" {
+				start, end, endExclusive, yearly, summary = time.Time{}, time.Time{}, false, false, ""
+			}
+		case "DTSTART":
+			start, _ = parseICSDate(value)
+		case "DTEND":
+			// all-day events end the day before DTEND
+			end, endExclusive = parseICSDate(value)
+		case "SUMMARY":
+			summary = icsUnescape.Replace(value)
+		case "RRULE":
+			yearly = strings.Contains(value, "FREQ=YEARLY")
+		case "END":
+			if value != "VEVENT" || start.IsZero() {
+				continue
+			}
+
+			if end.IsZero() {
+				end, endExclusive = start, false
+			}
+			for d := start; d.Before(end) || (!endExclusive && d.Equal(end)); d = d.AddDate(0, 0, 1) {
+				if yearly {
+					c.yearly[d.Format("01-02")] = summary
+					continue
+				}
+				c.holidays[d.Format("2006-01-02")] = summary
+			}
+		}
+	}
+
+	return c
+}
+
+// parse an iCalendar DATE (20211224) or DATE-TIME (20211224T100000Z) to its date
+// return true if the date is the exclusive end of an all-day event
+func parseICSDate(value string) (time.Time, bool) {
+	if len(value) < 8 {
+		return time.Time{}, false
+	}
+
+	d, err := time.Parse("20060102", value[:8])
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	// DATE, or DATE-TIME at midnight
+	return d, len(value) == 8 || strings.HasPrefix(value[8:], "T000000")
+}
+
+// check if date (in the instance timezone) is a holiday
+// return the holiday name
+func (c *Calendar) Holiday(date time.Time) (string, bool) {
+	if c == nil {
+		return "", false
+	}
+
+	if name, ok := c.holidays[date.Format("2006-01-02")]; ok {
+		return name, true
+	}
+	name, ok := c.yearly[date.Format("01-02")]
+	return name, ok
+}
+
+// first holiday from date on, within a year
+func (c *Calendar) NextHoliday(date time.Time) (time.Time, string, bool) {
+	for d := date; d.Before(date.AddDate(1, 0, 0)); d = d.AddDate(0, 0, 1) {
+		if name, ok := c.Holiday(d); ok {
+			return d, name, true
+		}
+	}
+
+	return time.Time{}, "", false
+}
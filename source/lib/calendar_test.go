@@ -0,0 +1,237 @@
+package lib
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	ssmtypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
+	"github.com/stretchr/testify/assert"
+)
+
+var _ S3ClientAPI = (*mockS3client)(nil)
+var _ SSMClientAPI = (*mockSSMclient)(nil)
+
+type mockS3client struct {
+	objects map[string]string
+	calls   int
+}
+
+func (m *mockS3client) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	m.calls++
+	object, ok := m.objects[fmt.Sprintf("%s/%s", *params.Bucket, *params.Key)]
+	if !ok {
+		return nil, fmt.Errorf("NoSuchKey")
+	}
+
+	return &s3.GetObjectOutput{Body: ioutil.NopCloser(strings.NewReader(object))}, nil
+}
+
+type mockSSMclient struct {
+	parameters map[string]string
+	// SecureString parameters, their value is only returned decrypted
+	secure map[string]bool
+}
+
+func (m *mockSSMclient) GetParameter(ctx context.Context, params *ssm.GetParameterInput, optFns ...func(*ssm.Options)) (*ssm.GetParameterOutput, error) {
+	if m.secure[*params.Name] {
+		if !params.WithDecryption {
+			return &ssm.GetParameterOutput{Parameter: &ssmtypes.Parameter{Type: ssmtypes.ParameterTypeSecureString, Value: aws.String("AQICAHh...")}}, nil
+		}
+		return &ssm.GetParameterOutput{Parameter: &ssmtypes.Parameter{Type: ssmtypes.ParameterTypeSecureString, Value: aws.String("hunter2")}}, nil
+	}
+
+	parameter, ok := m.parameters[*params.Name]
+	if !ok {
+		return nil, fmt.Errorf("ParameterNotFound")
+	}
+
+	return &ssm.GetParameterOutput{Parameter: &ssmtypes.Parameter{Type: ssmtypes.ParameterTypeString, Value: aws.String(parameter)}}, nil
+}
+
+const datesCalendar = `# Swedish holidays
+2021-12-24 Christmas Eve
+20211225 Christmas Day
+
+2021-06-25 Midsummer Eve
+`
+
+const icsCalendar = "BEGIN:VCALENDAR\r\n" +
+	"VERSION:2.0\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"DTSTART;VALUE=DATE:20211224\r\n" +
+	"DTEND;VALUE=DATE:20211227\r\n" +
+	"SUMMARY:Christmas\\, long weekend\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"DTSTART;VALUE=DATE:20210101\r\n" +
+	"RRULE:FREQ=YEARLY\r\n" +
+	"SUMMARY:New Year's\r\n" +
+	"  Day\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"DTSTART:20210625T080000Z\r\n" +
+	"DTEND:20210625T170000Z\r\n" +
+	"SUMMARY:Midsummer Eve\r\n" +
+	"END:VEVENT\r\n" +
+	"END:VCALENDAR\r\n"
+
+func TestCalendarHoliday(t *testing.T) {
+	tests := []struct {
+		name     string
+		calendar string
+		date     time.Time
+		wantName string
+		want     bool
+	}{
+		{
+			name:     "dates - holiday",
+			calendar: datesCalendar,
+			date:     time.Date(2021, 12, 24, 10, 00, 00, 00, time.UTC),
+			wantName: "Christmas Eve",
+			want:     true,
+		},
+		{
+			name:     "dates - compact layout",
+			calendar: datesCalendar,
+			date:     time.Date(2021, 12, 25, 10, 00, 00, 00, time.UTC),
+			wantName: "Christmas Day",
+			want:     true,
+		},
+		{
+			name:     "dates - not a holiday",
+			calendar: datesCalendar,
+			date:     time.Date(2021, 12, 23, 10, 00, 00, 00, time.UTC),
+			want:     false,
+		},
+		{
+			name:     "ics - all-day event, last day",
+			calendar: icsCalendar,
+			date:     time.Date(2021, 12, 26, 10, 00, 00, 00, time.UTC),
+			wantName: "Christmas, long weekend",
+			want:     true,
+		},
+		{
+			name:     "ics - all-day event, DTEND is exclusive",
+			calendar: icsCalendar,
+			date:     time.Date(2021, 12, 27, 10, 00, 00, 00, time.UTC),
+			want:     false,
+		},
+		{
+			name:     "ics - yearly event, folded summary",
+			calendar: icsCalendar,
+			date:     time.Date(2023, 01, 01, 10, 00, 00, 00, time.UTC),
+			wantName: "New Year's Day",
+			want:     true,
+		},
+		{
+			name:     "ics - timed event",
+			calendar: icsCalendar,
+			date:     time.Date(2021, 06, 25, 20, 00, 00, 00, time.UTC),
+			wantName: "Midsummer Eve",
+			want:     true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			name, got := ParseCalendar(test.calendar).Holiday(test.date)
+
+			assert.Equal(t, test.want, got)
+			assert.Equal(t, test.wantName, name)
+		})
+	}
+}
+
+func TestCalendarStoreLoad(t *testing.T) {
+	s3Client := &mockS3client{objects: map[string]string{"calendars/se.ics": icsCalendar}}
+	ssmClient := &mockSSMclient{
+		parameters: map[string]string{
+			"/ec2scheduler/calendars/se":   datesCalendar,
+			"/ec2scheduler/holidays":       datesCalendar,
+			"/ec2scheduler/calendarsecret": "hunter2",
+		},
+		secure: map[string]bool{"/ec2scheduler/calendars/secret": true},
+	}
+
+	tests := []struct {
+		name string
+		ref  string
+		err  bool
+	}{
+		{
+			name: "S3 object",
+			ref:  "s3://calendars/se.ics",
+		},
+		{
+			name: "S3 object - missing key",
+			ref:  "s3://calendars",
+			err:  true,
+		},
+		{
+			name: "SSM parameter",
+			ref:  "ssm:/ec2scheduler/calendars/se",
+		},
+		{
+			name: "SSM parameter - not found",
+			ref:  "ssm:/ec2scheduler/calendars/missing",
+			err:  true,
+		},
+		{
+			name: "SSM parameter - outside the prefix",
+			ref:  "ssm:/ec2scheduler/holidays",
+			err:  true,
+		},
+		{
+			name: "SSM parameter - prefix without its slash",
+			ref:  "ssm:/ec2scheduler/calendarsecret",
+			err:  true,
+		},
+		{
+			name: "SSM parameter - SecureString",
+			ref:  "ssm:/ec2scheduler/calendars/secret",
+			err:  true,
+		},
+		{
+			name: "local file",
+			ref:  "/var/task/main",
+			err:  true,
+		},
+	}
+
+	store := NewCalendarStore(s3Client, ssmClient, CalendarConfig{CalendarParameterPrefix: "/ec2scheduler/calendars"})
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := store.Load(context.Background(), test.ref)
+			if test.err {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			_, ok := got.Holiday(time.Date(2021, 12, 25, 00, 00, 00, 00, time.UTC))
+			assert.True(t, ok)
+		})
+	}
+
+	// calendars are loaded once per run
+	_, err := store.Load(context.Background(), "s3://calendars/se.ics")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, s3Client.calls)
+}
+
+func TestCalendarNextHoliday(t *testing.T) {
+	date, name, ok := ParseCalendar(datesCalendar).NextHoliday(time.Date(2021, 12, 01, 10, 00, 00, 00, time.UTC))
+	assert.True(t, ok)
+	assert.Equal(t, "Christmas Eve", name)
+	assert.Equal(t, "2021-12-24", date.Format("2006-01-02"))
+
+	_, _, ok = ParseCalendar(datesCalendar).NextHoliday(time.Date(2022, 01, 01, 10, 00, 00, 00, time.UTC))
+	assert.False(t, ok)
+}
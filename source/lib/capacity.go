@@ -0,0 +1,78 @@
+package lib
+
+import (
+	"context"
+	"errors"
+	"log"
+)
+
+// capacity saved in the capacity tag doesn't parse, the resource is left as it is
+var errInvalidCapacity = errors.New("invalid capacity")
+
+// resource stopped by scaling it to zero, its capacity saved in a tag until it is started
+// Auto Scaling groups (min=1,max=4,desired=2) and ECS services (desired=2)
+type capacityScaler interface {
+	// current capacity of the resource, as saved in the tag
+	capacity(ctx context.Context, r Resource) (string, error)
+	// scale the resource to a saved capacity, to zero if it is empty
+	// errInvalidCapacity if it doesn't parse, nothing is scaled
+	scale(ctx context.Context, r Resource, capacity string) error
+	CreateTags(ctx context.Context, resource Resource, tags map[string]string) error
+	DeleteTags(ctx context.Context, resource Resource, keys ...string) error
+}
+
+// restore the capacity saved in capacityTag, then delete the tag
+// a resource scaled to zero outside of the scheduler has nothing to restore, ErrUnchanged
+func startScaled(ctx context.Context, s capacityScaler, capacityTag string, resources []Resource) []error {
+	errs := make([]error, len(resources))
+	for i, r := range resources {
+		saved := r.Tags[capacityTag]
+		if saved == "" {
+			log.Printf("[%s/%s] no capacity saved in %s, left at zero", r.Region, r.ID, capacityTag)
+			errs[i] = ErrUnchanged
+			continue
+		}
+
+		errs[i] = s.scale(ctx, r, saved)
+		if errors.Is(errs[i], errInvalidCapacity) {
+			log.Printf("[%s/%s] %s: %s", r.Region, r.ID, capacityTag, errs[i])
+			errs[i] = ErrUnchanged
+			continue
+		}
+		if errs[i] != nil {
+			continue
+		}
+		log.Printf("[%s/%s] capacity restored to %s", r.Region, r.ID, saved)
+
+		// only needed while scaled to zero, a leftover is overwritten on the next stop
+		if err := s.DeleteTags(ctx, r, capacityTag); err != nil {
+			log.Printf("[%s/%s] unable to delete %s: %s", r.Region, r.ID, capacityTag, err)
+		}
+	}
+
+	return errs
+}
+
+// save the capacity in capacityTag, then scale to zero
+func stopScaled(ctx context.Context, s capacityScaler, capacityTag string, resources []Resource) []error {
+	errs := make([]error, len(resources))
+	for i, r := range resources {
+		current, err := s.capacity(ctx, r)
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+
+		// saved first, the resource can't be restored without it
+		if errs[i] = s.CreateTags(ctx, r, map[string]string{capacityTag: current}); errs[i] != nil {
+			continue
+		}
+		if errs[i] = s.scale(ctx, r, ""); errs[i] != nil {
+			continue
+		}
+
+		log.Printf("[%s/%s] scaled to zero, %s saved", r.Region, r.ID, current)
+	}
+
+	return errs
+}
@@ -0,0 +1,32 @@
+// Package lib is shared by the ec2scheduler Lambda functions:
+// tag names, schedule and date parsing, holiday calendars and EC2 tag access.
+package lib
+
+// names of the tags the scheduler reads and writes on a resource
+// every function shares them, so a renamed tag is renamed everywhere
+type TagConfig struct {
+	ScheduleTag        string `env:"SCHEDULE_TAG" envDefault:"Schedule"`
+	ScheduleTagDay     string `env:"SCHEDULE_TAG_DAY" envDefault:"ScheduleDay"`
+	ScheduleTagSuspend string `env:"SCHEDULE_TAG_SUSPEND" envDefault:"ScheduleSuspendUntil"`
+	// state enforced while suspended, see SuspendModes
+	ScheduleTagSuspendMode string `env:"SCHEDULE_TAG_SUSPEND_MODE" envDefault:"ScheduleSuspendMode"`
+	ScheduleTagSNS         string `env:"SCHEDULE_TAG_SNS" envDefault:"ScheduleSNS"`
+	ScheduleTagTZ          string `env:"SCHEDULE_TAG_TZ" envDefault:"ScheduleTimezone"`
+
+	ScheduleTagCalendar string `env:"SCHEDULE_TAG_CALENDAR" envDefault:"ScheduleCalendar"`
+	ScheduleTagFrom     string `env:"SCHEDULE_TAG_FROM" envDefault:"ScheduleFrom"`
+	ScheduleTagUntil    string `env:"SCHEDULE_TAG_UNTIL" envDefault:"ScheduleUntil"`
+
+	// notice given before a stop (15m), and the stop already warned about
+	ScheduleTagWarn   string `env:"SCHEDULE_TAG_WARN" envDefault:"ScheduleWarn"`
+	ScheduleTagWarned string `env:"SCHEDULE_TAG_WARNED" envDefault:"ScheduleWarnedStop"`
+
+	// capacity of an Auto Scaling group scaled to zero, restored on start
+	ScheduleTagCapacity string `env:"SCHEDULE_TAG_CAPACITY" envDefault:"ScheduleCapacity"`
+	// when the engine stopped an RDS database, to stop it again once AWS restarts it after 7 days
+	ScheduleTagStopped string `env:"SCHEDULE_TAG_STOPPED" envDefault:"ScheduleStoppedAt"`
+
+	// who disabled the scheduler and why, removed on enable
+	ScheduleTagDisabledBy     string `env:"SCHEDULE_TAG_DISABLED_BY" envDefault:"ScheduleDisabledBy"`
+	ScheduleTagDisabledReason string `env:"SCHEDULE_TAG_DISABLED_REASON" envDefault:"ScheduleDisabledReason"`
+}
@@ -0,0 +1,273 @@
+package lib
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cron expression: minute hour day-of-month month day-of-week
+// every field is a bitset of the allowed values
+type CronSchedule struct {
+	expr   string
+	minute uint64
+	hour   uint64
+	dom    uint64
+	month  uint64
+	dow    uint64
+
+	// day-of-week entries bound to the week of the month (1#1 first Monday, 5L last Friday)
+	dowNth []nthWeekday
+
+	// unrestricted day-of-month/day-of-week (*), see Match
+	domAny bool
+	dowAny bool
+}
+
+type nthWeekday struct {
+	weekday time.Weekday
+	// 1-5, -1 last of the month
+	n int
+}
+
+var cronMonthNames = map[string]int{
+	"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+	"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+}
+
+var cronDowNames = map[string]int{
+	"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+}
+
+// check if the Schedule tag holds cron expressions rather than time windows
+func IsCronSchedule(value string) bool {
+	value = strings.TrimSpace(value)
+	return strings.HasPrefix(value, "start=") || strings.HasPrefix(value, "stop=")
+}
+
+// parse the Schedule tag cron expressions
+// start=0 7 * * 1-5;stop=30 18 * * 1-5, either start or stop can be omitted, not repeated
+func ParseCronSchedule(value string) (*CronSchedule, *CronSchedule, error) {
+	var start, stop *CronSchedule
+	for _, part := range strings.Split(value, ";") {
+		keyExpr := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(keyExpr) != 2 {
+			return nil, nil, fmt.Errorf("invalid cron schedule %s", part)
+		}
+
+		c, err := ParseCron(keyExpr[1])
+		if err != nil {
+			return nil, nil, err
+		}
+
+		// the last of a repeated key would silently win
+		switch keyExpr[0] {
+		case "start":
+			if start != nil {
+				return nil, nil, fmt.Errorf("invalid cron schedule %s, start= is repeated", value)
+			}
+			start = c
+		case "stop":
+			if stop != nil {
+				return nil, nil, fmt.Errorf("invalid cron schedule %s, stop= is repeated", value)
+			}
+			stop = c
+		default:
+			return nil, nil, fmt.Errorf("invalid cron schedule %s, expected start= or stop=", part)
+		}
+	}
+
+	return start, stop, nil
+}
+
+// parse a standard 5 fields cron expression
+// supports *, lists (1,3), ranges (1-5), steps (*/15, 8-18/2), month and day names (jan, mon),
+// nth day of the month (1#1 first Monday) and last day of the month (5L last Friday)
+func ParseCron(expr string) (*CronSchedule, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("invalid cron expression %s, expected 5 fields", expr)
+	}
+
+	c := &CronSchedule{
+		expr:   strings.Join(fields, " "),
+		domAny: fields[2] == "*",
+		dowAny: fields[4] == "*",
+	}
+
+	var err error
+	if c.minute, err = parseCronField(fields[0], 0, 59, nil); err != nil {
+		return nil, fmt.Errorf("invalid cron minute %s: %s", fields[0], err)
+	}
+	if c.hour, err = parseCronField(fields[1], 0, 23, nil); err != nil {
+		return nil, fmt.Errorf("invalid cron hour %s: %s", fields[1], err)
+	}
+	if c.dom, err = parseCronField(fields[2], 1, 31, nil); err != nil {
+		return nil, fmt.Errorf("invalid cron day of month %s: %s", fields[2], err)
+	}
+	if c.month, err = parseCronField(fields[3], 1, 12, cronMonthNames); err != nil {
+		return nil, fmt.Errorf("invalid cron month %s: %s", fields[3], err)
+	}
+	if err = c.parseDow(fields[4]); err != nil {
+		return nil, fmt.Errorf("invalid cron day of week %s: %s", fields[4], err)
+	}
+
+	return c, nil
+}
+
+// parse day-of-week, 0 and 7 are both Sunday
+func (c *CronSchedule) parseDow(field string) error {
+	for _, part := range strings.Split(field, ",") {
+		// nth day of the month (1#2 second Monday)
+		if dayN := strings.SplitN(part, "#", 2); len(dayN) == 2 {
+			day, err := cronValue(dayN[0], cronDowNames)
+			if err != nil || day < 0 || day > 7 {
+				return fmt.Errorf("invalid day %s", dayN[0])
+			}
+			n, err := strconv.Atoi(dayN[1])
+			if err != nil || n < 1 || n > 5 {
+				return fmt.Errorf("invalid week of the month %s", dayN[1])
+			}
+			c.dowNth = append(c.dowNth, nthWeekday{weekday: time.Weekday(day % 7), n: n})
+			continue
+		}
+
+		// last day of the month (5L last Friday)
+		if strings.HasSuffix(part, "L") && len(part) > 1 {
+			day, err := cronValue(strings.TrimSuffix(part, "L"), cronDowNames)
+			if err != nil || day < 0 || day > 7 {
+				return fmt.Errorf("invalid day %s", part)
+			}
+			c.dowNth = append(c.dowNth, nthWeekday{weekday: time.Weekday(day % 7), n: -1})
+			continue
+		}
+
+		bits, err := parseCronField(part, 0, 7, cronDowNames)
+		if err != nil {
+			return err
+		}
+		c.dow |= bits
+	}
+
+	// 7 is Sunday
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1
+	}
+
+	return nil
+}
+
+// parse a cron field into a bitset of values between min and max
+func parseCronField(field string, min, max int, names map[string]int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rangeStep := strings.SplitN(part, "/", 2)
+
+		first, last := min, max
+		if rangeStep[0] != "*" {
+			firstLast := strings.SplitN(rangeStep[0], "-", 2)
+
+			var err error
+			if first, err = cronValue(firstLast[0], names); err != nil {
+				return 0, err
+			}
+			last = first
+			if len(firstLast) == 2 {
+				if last, err = cronValue(firstLast[1], names); err != nil {
+					return 0, err
+				}
+			} else if len(rangeStep) == 2 {
+				// 5/15 = 5-max/15
+				last = max
+			}
+		}
+
+		step := 1
+		if len(rangeStep) == 2 {
+			var err error
+			if step, err = strconv.Atoi(rangeStep[1]); err != nil || step < 1 {
+				return 0, fmt.Errorf("invalid step %s", rangeStep[1])
+			}
+		}
+
+		if first < min || last > max || first > last {
+			return 0, fmt.Errorf("%s out of range %d-%d", part, min, max)
+		}
+
+		for v := first; v <= last; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+
+	return bits, nil
+}
+
+// parse a number or a name (jan, mon)
+func cronValue(value string, names map[string]int) (int, error) {
+	if v, ok := names[strings.ToLower(value)]; ok {
+		return v, nil
+	}
+
+	v, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %s", value)
+	}
+
+	return v, nil
+}
+
+// check if the cron expression fires at t (by the minute, in t location)
+// like cron, if both day-of-month and day-of-week are restricted either one has to match
+func (c *CronSchedule) Match(t time.Time) bool {
+	if c.minute&(1<<uint(t.Minute())) == 0 ||
+		c.hour&(1<<uint(t.Hour())) == 0 ||
+		c.month&(1<<uint(t.Month())) == 0 {
+		return false
+	}
+
+	domMatch := c.dom&(1<<uint(t.Day())) != 0
+	dowMatch := c.dow&(1<<uint(t.Weekday())) != 0
+	for _, nth := range c.dowNth {
+		if nth.weekday != t.Weekday() {
+			continue
+		}
+
+		// last weekday of the month: a week later is next month
+		if nth.n == -1 && t.AddDate(0, 0, 7).Month() != t.Month() {
+			dowMatch = true
+		}
+		if nth.n == (t.Day()-1)/7+1 {
+			dowMatch = true
+		}
+	}
+
+	if c.domAny || c.dowAny {
+		return domMatch && dowMatch
+	}
+
+	return domMatch || dowMatch
+}
+
+// latest time in (from, to] the cron expression fires at, by the minute
+func (c *CronSchedule) LastBetween(from, to time.Time) (time.Time, bool) {
+	if c == nil {
+		return time.Time{}, false
+	}
+
+	for t := to.Truncate(time.Minute); t.After(from); t = t.Add(-time.Minute) {
+		if c.Match(t) {
+			return t, true
+		}
+	}
+
+	return time.Time{}, false
+}
+
+func (c *CronSchedule) String() string {
+	if c == nil {
+		return "-"
+	}
+
+	return c.expr
+}
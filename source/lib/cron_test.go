@@ -0,0 +1,156 @@
+package lib
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCronSchedule(t *testing.T) {
+	tests := []struct {
+		name      string
+		value     string
+		wantStart string
+		wantStop  string
+		err       bool
+	}{
+		{
+			name:      "start and stop",
+			value:     "start=0 7 * * 1-5;stop=30 18 * * 1-5",
+			wantStart: "0 7 * * 1-5",
+			wantStop:  "30 18 * * 1-5",
+		},
+		{
+			name:      "stop only",
+			value:     "stop=0  19 * * *",
+			wantStart: "-",
+			wantStop:  "0 19 * * *",
+		},
+		{
+			name:  "unknown key",
+			value: "start=0 7 * * 1-5;halt=30 18 * * 1-5",
+			err:   true,
+		},
+		{
+			name:  "repeated start",
+			value: "start=0 7 * * 1-5;start=0 9 * * 6",
+			err:   true,
+		},
+		{
+			name:  "repeated stop",
+			value: "stop=0 19 * * *;start=0 7 * * *;stop=0 20 * * *",
+			err:   true,
+		},
+		{
+			name:  "missing field",
+			value: "start=0 7 * 1-5",
+			err:   true,
+		},
+		{
+			name:  "out of range",
+			value: "start=0 24 * * *",
+			err:   true,
+		},
+		{
+			name:  "invalid week of the month",
+			value: "start=0 7 * * 1#6",
+			err:   true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.True(t, IsCronSchedule(test.value))
+
+			start, stop, err := ParseCronSchedule(test.value)
+			if test.err {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, test.wantStart, start.String())
+			assert.Equal(t, test.wantStop, stop.String())
+		})
+	}
+}
+
+func TestCronMatch(t *testing.T) {
+	tests := []struct {
+		name string
+		expr string
+		time time.Time
+		want bool
+	}{
+		{
+			name: "weekdays - Monday",
+			expr: "0 7 * * 1-5",
+			time: time.Date(2021, 01, 04, 7, 00, 00, 00, time.UTC), // Monday
+			want: true,
+		},
+		{
+			name: "weekdays - Sunday",
+			expr: "0 7 * * 1-5",
+			time: time.Date(2021, 01, 03, 7, 00, 00, 00, time.UTC), // Sunday
+			want: false,
+		},
+		{
+			name: "wrong minute",
+			expr: "0 7 * * 1-5",
+			time: time.Date(2021, 01, 04, 7, 01, 00, 00, time.UTC),
+			want: false,
+		},
+		{
+			name: "step and names",
+			expr: "*/15 8-18/2 * jan-mar mon,wed",
+			time: time.Date(2021, 03, 03, 10, 45, 00, 00, time.UTC), // Wednesday
+			want: true,
+		},
+		{
+			name: "7 is Sunday",
+			expr: "0 7 * * 7",
+			time: time.Date(2021, 01, 03, 7, 00, 00, 00, time.UTC), // Sunday
+			want: true,
+		},
+		{
+			name: "first Monday of the month",
+			expr: "0 7 * * 1#1",
+			time: time.Date(2021, 02, 01, 7, 00, 00, 00, time.UTC),
+			want: true,
+		},
+		{
+			name: "second Monday of the month",
+			expr: "0 7 * * 1#1",
+			time: time.Date(2021, 02, 8, 7, 00, 00, 00, time.UTC),
+			want: false,
+		},
+		{
+			name: "last Friday of the month",
+			expr: "0 18 * * 5L",
+			time: time.Date(2021, 01, 29, 18, 00, 00, 00, time.UTC),
+			want: true,
+		},
+		{
+			name: "not the last Friday of the month",
+			expr: "0 18 * * 5L",
+			time: time.Date(2021, 01, 22, 18, 00, 00, 00, time.UTC),
+			want: false,
+		},
+		{
+			name: "day of month or day of week",
+			expr: "0 7 15 * 1",
+			time: time.Date(2021, 01, 15, 7, 00, 00, 00, time.UTC), // Friday
+			want: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c, err := ParseCron(test.expr)
+			assert.NoError(t, err)
+
+			assert.Equal(t, test.want, c.Match(test.time))
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package lib
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	// embed the timezone database, the Lambda runtime doesn't always ship one
+	// every function linking lib gets it along with LoadLocation
+	_ "time/tzdata"
+)
+
+// ScheduleSuspendUntil, ScheduleFrom and ScheduleUntil layouts, by length
+var DateLayouts = map[int]string{
+	4:  "2006",
+	6:  "200601",
+	8:  "20060102",
+	11: "20060102T15",
+	14: "20060102T15:04",
+}
+
+// parse a date tag in the instance timezone
+func ParseDate(value string, location *time.Location) (time.Time, error) {
+	layout, ok := DateLayouts[len(value)]
+	if !ok {
+		return time.Time{}, fmt.Errorf("layout doesn't match any supported one")
+	}
+
+	return time.ParseInLocation(layout, value, location)
+}
+
+// load the ScheduleTimezone location (IANA name), UTC if empty
+// on error UTC is returned along with the error
+func LoadLocation(name string) (*time.Location, error) {
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		return time.UTC, err
+	}
+
+	return location, nil
+}
+
+// canonical ScheduleSuspendUntil layout, relative suspend times are stored like this
+const SuspendLayout = "20060102T15:04"
+
+// parse a suspend time, absolute (DateLayouts) or relative to now, in now location
+// 3h, 90m, 1h30m, 2d, 1w      Go duration, plus days and weeks, optionally "for 3h" or "in 3h"
+// end of day, eod, tomorrow   next midnight
+// end of week, next week      next Monday midnight
+// monday, next monday         next Monday midnight, never today
+// "until " is accepted in front of any of them (until end of day)
+func ParseSuspendUntil(value string, now time.Time) (time.Time, error) {
+	if t, err := ParseDate(value, now.Location()); err == nil {
+		return t, nil
+	}
+
+	value = strings.ToLower(strings.Join(strings.Fields(value), " "))
+	value = strings.TrimPrefix(value, "until ")
+
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	switch value {
+	case "end of day", "eod", "tomorrow":
+		return midnight.AddDate(0, 0, 1), nil
+	case "end of week", "eow", "next week":
+		return nextWeekday(midnight, time.Monday), nil
+	}
+
+	day := strings.TrimPrefix(value, "next ")
+	if weekday, ok := WeekdayNames[day]; ok {
+		return nextWeekday(midnight, weekday), nil
+	}
+
+	d, err := parseDuration(strings.TrimPrefix(strings.TrimPrefix(value, "for "), "in "))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("unable to parse suspend time %s", value)
+	}
+	if d <= 0 {
+		return time.Time{}, fmt.Errorf("suspend duration %s is not positive", value)
+	}
+
+	return now.Add(d), nil
+}
+
+// first weekday after date (never date itself)
+func nextWeekday(date time.Time, weekday time.Weekday) time.Time {
+	days := (int(weekday) - int(date.Weekday()) + 7) % 7
+	if days == 0 {
+		days = 7
+	}
+
+	return date.AddDate(0, 0, days)
+}
+
+// Go duration, plus days (2d) and weeks (1w)
+func parseDuration(value string) (time.Duration, error) {
+	value = strings.Replace(value, " ", "", -1)
+	for unit, d := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if !strings.HasSuffix(value, unit) {
+			continue
+		}
+
+		n, err := strconv.Atoi(strings.TrimSuffix(value, unit))
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(n) * d, nil
+	}
+
+	return time.ParseDuration(value)
+}
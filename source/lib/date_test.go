@@ -0,0 +1,109 @@
+package lib
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseDate(t *testing.T) {
+	stockholm, _ := time.LoadLocation("Europe/Stockholm")
+
+	got, err := ParseDate("20210401T12:30", stockholm)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2021, 04, 01, 10, 30, 00, 00, time.UTC), got.UTC())
+
+	_, err = ParseDate("2021-04-01", stockholm)
+	assert.Error(t, err)
+}
+
+func TestLoadLocation(t *testing.T) {
+	got, err := LoadLocation("Europe/Stockholm")
+	assert.NoError(t, err)
+	assert.Equal(t, "Europe/Stockholm", got.String())
+
+	got, err = LoadLocation("")
+	assert.NoError(t, err)
+	assert.Equal(t, time.UTC, got)
+
+	got, err = LoadLocation("Europe/Nowhere")
+	assert.Error(t, err)
+	assert.Equal(t, time.UTC, got)
+}
+
+func TestParseSuspendUntil(t *testing.T) {
+	stockholm, _ := time.LoadLocation("Europe/Stockholm")
+	now := time.Date(2021, 04, 07, 10, 15, 30, 00, stockholm) // Wednesday
+
+	tests := []struct {
+		name  string
+		value string
+		want  time.Time
+		err   bool
+	}{
+		{
+			name:  "absolute",
+			value: "20210410T08",
+			want:  time.Date(2021, 04, 10, 8, 00, 00, 00, stockholm),
+		},
+		{
+			name:  "duration",
+			value: "3h",
+			want:  time.Date(2021, 04, 07, 13, 15, 30, 00, stockholm),
+		},
+		{
+			name:  "for duration",
+			value: "for 1h30m",
+			want:  time.Date(2021, 04, 07, 11, 45, 30, 00, stockholm),
+		},
+		{
+			name:  "days",
+			value: "in 2d",
+			want:  time.Date(2021, 04, 9, 10, 15, 30, 00, stockholm),
+		},
+		{
+			name:  "end of day",
+			value: "until end of day",
+			want:  time.Date(2021, 04, 8, 00, 00, 00, 00, stockholm),
+		},
+		{
+			name:  "next monday",
+			value: "until next Monday",
+			want:  time.Date(2021, 04, 12, 00, 00, 00, 00, stockholm),
+		},
+		{
+			name:  "weekday is never today",
+			value: "wed",
+			want:  time.Date(2021, 04, 14, 00, 00, 00, 00, stockholm),
+		},
+		{
+			name:  "end of week",
+			value: "End  of  week",
+			want:  time.Date(2021, 04, 12, 00, 00, 00, 00, stockholm),
+		},
+		{
+			name:  "negative duration",
+			value: "-3h",
+			err:   true,
+		},
+		{
+			name:  "unknown",
+			value: "whenever",
+			err:   true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := ParseSuspendUntil(test.value, now)
+			if test.err {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.True(t, test.want.Equal(got), "want %s, got %s", test.want, got)
+		})
+	}
+}
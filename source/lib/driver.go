@@ -0,0 +1,145 @@
+package lib
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/autoscaling"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	"github.com/aws/aws-sdk-go-v2/service/rds"
+)
+
+// state of a scheduled resource, whatever its type
+// drivers map their own states to running/stopped, a resource in transition keeps its own (pending, backing-up, ...)
+type State string
+
+const (
+	StateRunning State = "running"
+	StateStopped State = "stopped"
+)
+
+// types of the scheduled resources
+const (
+	ResourceTypeInstance         = "instance"
+	ResourceTypeAutoScalingGroup = "autoScalingGroup"
+	ResourceTypeDBInstance       = "dbInstance"
+	ResourceTypeDBCluster        = "dbCluster"
+	ResourceTypeECSService       = "ecsService"
+)
+
+// resource of Get doesn't exist
+var ErrNotFound = errors.New("resource not found")
+
+// start/stop left the resource as it is, e.g. a group scaled to zero by hand has no capacity to restore
+var ErrUnchanged = errors.New("nothing to restore, left unchanged")
+
+// Resource scheduled by a Driver
+type Resource struct {
+	// one of the ResourceType* constants
+	Type string
+	// instance id, Auto Scaling group or database name, cluster/service of ECS services
+	ID string
+	// Name tag of instances, the name of the other resources
+	Name string
+	// Arn, the tags of RDS databases and ECS services are written through it
+	ARN     string
+	Account string
+	Region  string
+	State   State
+	Tags    map[string]string
+}
+
+// Driver lists, starts and stops the resources of a type (or a few related types) in a region,
+// and reads and writes the scheduler tags on them
+// NewDrivers builds the drivers of every supported type, libtest.FakeDriver is an in-memory one for tests
+type Driver interface {
+	// resource types the driver handles, see DriverOf
+	Types() []string
+	// resources carrying tagKey, running or stopped ones only
+	List(ctx context.Context, tagKey string) ([]Resource, error)
+	// resource of resourceType by id, whatever its state, ErrNotFound if there is none
+	Get(ctx context.Context, resourceType, id string) (Resource, error)
+	// start or stop the resources, return the error of every resource, in the same order
+	// a nil error is a state change, ErrUnchanged none
+	Start(ctx context.Context, resources []Resource) []error
+	Stop(ctx context.Context, resources []Resource) []error
+	// create or overwrite tags of a resource
+	CreateTags(ctx context.Context, resource Resource, tags map[string]string) error
+	// delete tags of a resource, whatever their value
+	DeleteTags(ctx context.Context, resource Resource, keys ...string) error
+}
+
+// drivers of every supported resource type in region, through cfg credentials
+func NewDrivers(cfg aws.Config, region string, conf TagConfig) []Driver {
+	return []Driver{
+		NewEC2Driver(ec2.NewFromConfig(cfg, func(o *ec2.Options) {
+			o.Region = region
+		}), region),
+		NewAutoScalingDriver(autoscaling.NewFromConfig(cfg, func(o *autoscaling.Options) {
+			o.Region = region
+		}), region, conf.ScheduleTagCapacity),
+		NewRDSDriver(rds.NewFromConfig(cfg, func(o *rds.Options) {
+			o.Region = region
+		}), region, conf.ScheduleTagStopped),
+		NewECSDriver(ecs.NewFromConfig(cfg, func(o *ecs.Options) {
+			o.Region = region
+		}), region, conf.ScheduleTagCapacity),
+	}
+}
+
+// driver handling resourceType, nil if none does
+func DriverOf(drivers []Driver, resourceType string) Driver {
+	for _, driver := range drivers {
+		for _, t := range driver.Types() {
+			if t == resourceType {
+				return driver
+			}
+		}
+	}
+
+	return nil
+}
+
+// resources carrying tagKey of every driver, and the error of every failing driver
+// a driver failing (e.g. the role of an account doesn't allow listing RDS) doesn't stop the others,
+// callers tell a partial failure from a complete one by the number of errors, as with ForEachRegion
+func ListResources(ctx context.Context, drivers []Driver, tagKey string) ([]Resource, map[Driver]error) {
+	resources := []Resource{}
+	errs := map[Driver]error{}
+	for _, driver := range drivers {
+		list, err := driver.List(ctx, tagKey)
+		if err != nil {
+			log.Printf("unable to list %s: %s", strings.Join(driver.Types(), ", "), err)
+			errs[driver] = err
+			continue
+		}
+		resources = append(resources, list...)
+	}
+
+	return resources, errs
+}
+
+// tags sorted by key, the order of the API calls doesn't depend on map iteration
+func sortedKeys(tags map[string]string) []string {
+	keys := []string{}
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// account id of an Arn, arn:<partition>:<service>:<region>:<account>:...
+func arnAccount(arn string) string {
+	if parts := strings.SplitN(arn, ":", 6); len(parts) == 6 {
+		return parts[4]
+	}
+
+	return ""
+}
@@ -0,0 +1,70 @@
+package lib
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var _ Driver = (*mockDriver)(nil)
+
+// mockDriver lists its resources, or fails with err
+type mockDriver struct {
+	resources []Resource
+	err       error
+}
+
+func (m *mockDriver) Types() []string {
+	return nil
+}
+
+func (m *mockDriver) List(ctx context.Context, tagKey string) ([]Resource, error) {
+	return m.resources, m.err
+}
+
+func (m *mockDriver) Get(ctx context.Context, resourceType, id string) (Resource, error) {
+	return Resource{}, ErrNotFound
+}
+
+func (m *mockDriver) Start(ctx context.Context, resources []Resource) []error {
+	return make([]error, len(resources))
+}
+
+func (m *mockDriver) Stop(ctx context.Context, resources []Resource) []error {
+	return make([]error, len(resources))
+}
+
+func (m *mockDriver) CreateTags(ctx context.Context, resource Resource, tags map[string]string) error {
+	return nil
+}
+
+func (m *mockDriver) DeleteTags(ctx context.Context, resource Resource, keys ...string) error {
+	return nil
+}
+
+func TestDriverOf(t *testing.T) {
+	ec2Driver := NewEC2Driver(&mockEC2client{}, "eu-west-1")
+	rdsDriver := NewRDSDriver(&mockRDSClient{}, "eu-west-1", "ScheduleStoppedAt")
+	drivers := []Driver{ec2Driver, rdsDriver}
+
+	assert.Equal(t, Driver(ec2Driver), DriverOf(drivers, ResourceTypeInstance))
+	assert.Equal(t, Driver(rdsDriver), DriverOf(drivers, ResourceTypeDBCluster))
+	assert.Nil(t, DriverOf(drivers, ResourceTypeECSService))
+}
+
+func TestListResources(t *testing.T) {
+	instance := Resource{Type: ResourceTypeInstance, ID: "i-1", State: StateRunning, Tags: map[string]string{"Schedule": "07:00-19:00"}}
+	group := Resource{Type: ResourceTypeAutoScalingGroup, ID: "web", State: StateStopped, Tags: map[string]string{"Schedule": "07:00-19:00"}}
+
+	got, errs := ListResources(context.Background(), []Driver{&mockDriver{resources: []Resource{instance}}, &mockDriver{resources: []Resource{group}}}, "Schedule")
+	assert.Empty(t, errs)
+	assert.Equal(t, []Resource{instance, group}, got)
+
+	// a failing driver is skipped, its error returned with the resources of the others
+	failing := &mockDriver{err: fmt.Errorf("AccessDenied")}
+	got, errs = ListResources(context.Background(), []Driver{&mockDriver{resources: []Resource{instance}}, failing}, "Schedule")
+	assert.Equal(t, map[Driver]error{failing: fmt.Errorf("AccessDenied")}, errs)
+	assert.Equal(t, []Resource{instance}, got)
+}
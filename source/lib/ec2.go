@@ -0,0 +1,266 @@
+package lib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/smithy-go"
+)
+
+// EC2 calls to read and write the scheduler tags, *ec2.Client implements it
+type EC2TagsAPI interface {
+	CreateTags(ctx context.Context, params *ec2.CreateTagsInput, optFns ...func(*ec2.Options)) (*ec2.CreateTagsOutput, error)
+	DeleteTags(ctx context.Context, params *ec2.DeleteTagsInput, optFns ...func(*ec2.Options)) (*ec2.DeleteTagsOutput, error)
+}
+
+// create or overwrite tags of an instance
+func CreateTags(ctx context.Context, client EC2TagsAPI, instanceID string, tags []types.Tag) error {
+	_, err := client.CreateTags(ctx, &ec2.CreateTagsInput{
+		Resources: []string{instanceID},
+		Tags:      tags,
+	})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// delete tags of an instance, whatever their value
+func DeleteTags(ctx context.Context, client EC2TagsAPI, instanceID string, keys ...string) error {
+	tags := []types.Tag{}
+	for _, key := range keys {
+		tags = append(tags, types.Tag{Key: aws.String(key)})
+	}
+
+	_, err := client.DeleteTags(ctx, &ec2.DeleteTagsInput{
+		Resources: []string{instanceID},
+		Tags:      tags,
+	})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// instance tags by key
+func InstanceTags(instance types.Instance) map[string]string {
+	tags := map[string]string{}
+	for _, tag := range instance.Tags {
+		tags[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+	}
+
+	return tags
+}
+
+// describe instances matching input, following NextToken
+// return the reservations of all pages
+func DescribeInstances(ctx context.Context, client ec2.DescribeInstancesAPIClient, input *ec2.DescribeInstancesInput) ([]types.Reservation, error) {
+	reservations := []types.Reservation{}
+
+	paginator := ec2.NewDescribeInstancesPaginator(client, input)
+	for paginator.HasMorePages() {
+		resp, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		reservations = append(reservations, resp.Reservations...)
+	}
+
+	return reservations, nil
+}
+
+// instances per StartInstances/StopInstances call
+const maxInstancesPerCall = 50
+
+// EC2 calls of the instance driver, *ec2.Client implements it
+type EC2API interface {
+	EC2TagsAPI
+	ec2.DescribeInstancesAPIClient
+	StartInstances(ctx context.Context, params *ec2.StartInstancesInput, optFns ...func(*ec2.Options)) (*ec2.StartInstancesOutput, error)
+	StopInstances(ctx context.Context, params *ec2.StopInstancesInput, optFns ...func(*ec2.Options)) (*ec2.StopInstancesOutput, error)
+}
+
+// EC2Driver schedules the instances of a region
+type EC2Driver struct {
+	client EC2API
+	region string
+}
+
+func NewEC2Driver(client EC2API, region string) *EC2Driver {
+	return &EC2Driver{client: client, region: region}
+}
+
+func (d *EC2Driver) Types() []string {
+	return []string{ResourceTypeInstance}
+}
+
+func (d *EC2Driver) List(ctx context.Context, tagKey string) ([]Resource, error) {
+	reservations, err := DescribeInstances(ctx, d.client, &ec2.DescribeInstancesInput{
+		Filters: []types.Filter{
+			{
+				Name:   aws.String("instance-state-name"),
+				Values: []string{"running", "stopped"},
+			},
+			{
+				Name:   aws.String("tag-key"),
+				Values: []string{tagKey},
+			},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return d.resources(reservations), nil
+}
+
+func (d *EC2Driver) Get(ctx context.Context, resourceType, id string) (Resource, error) {
+	reservations, err := DescribeInstances(ctx, d.client, &ec2.DescribeInstancesInput{
+		InstanceIds: []string{id},
+	})
+	if err != nil {
+		return Resource{}, err
+	}
+
+	resources := d.resources(reservations)
+	if len(resources) < 1 {
+		return Resource{}, ErrNotFound
+	}
+
+	return resources[0], nil
+}
+
+// resources of every instance of every reservation
+func (d *EC2Driver) resources(reservations []types.Reservation) []Resource {
+	resources := []Resource{}
+	for _, reservation := range reservations {
+		for _, instance := range reservation.Instances {
+			tags := InstanceTags(instance)
+			resources = append(resources, Resource{
+				Type:    ResourceTypeInstance,
+				ID:      aws.ToString(instance.InstanceId),
+				Name:    tags["Name"],
+				Account: aws.ToString(reservation.OwnerId),
+				Region:  d.region,
+				State:   State(instance.State.Name),
+				Tags:    tags,
+			})
+		}
+	}
+
+	return resources
+}
+
+func (d *EC2Driver) Start(ctx context.Context, resources []Resource) []error {
+	return changeInstancesState(ctx, resources, StateRunning, func(ctx context.Context, ids []string) ([]types.InstanceStateChange, error) {
+		resp, err := d.client.StartInstances(ctx, &ec2.StartInstancesInput{
+			InstanceIds: ids,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return resp.StartingInstances, nil
+	})
+}
+
+func (d *EC2Driver) Stop(ctx context.Context, resources []Resource) []error {
+	return changeInstancesState(ctx, resources, StateStopped, func(ctx context.Context, ids []string) ([]types.InstanceStateChange, error) {
+		resp, err := d.client.StopInstances(ctx, &ec2.StopInstancesInput{
+			InstanceIds: ids,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return resp.StoppingInstances, nil
+	})
+}
+
+func (d *EC2Driver) CreateTags(ctx context.Context, resource Resource, tags map[string]string) error {
+	ec2Tags := []types.Tag{}
+	for _, k := range sortedKeys(tags) {
+		ec2Tags = append(ec2Tags, types.Tag{Key: aws.String(k), Value: aws.String(tags[k])})
+	}
+
+	return CreateTags(ctx, d.client, resource.ID, ec2Tags)
+}
+
+func (d *EC2Driver) DeleteTags(ctx context.Context, resource Resource, keys ...string) error {
+	return DeleteTags(ctx, d.client, resource.ID, keys...)
+}
+
+// call change for batches of maxInstancesPerCall instances, return the error of every instance
+// a single instance (e.g. in the wrong state) fails the whole call, so a failed batch is retried one instance at a time,
+// unless it was throttled: a call per instance would only make it worse, the whole batch fails
+func changeInstancesState(ctx context.Context, resources []Resource, state State, change func(ctx context.Context, ids []string) ([]types.InstanceStateChange, error)) []error {
+	errs := make([]error, len(resources))
+	for i := 0; i < len(resources); i += maxInstancesPerCall {
+		end := i + maxInstancesPerCall
+		if end > len(resources) {
+			end = len(resources)
+		}
+		batch := resources[i:end]
+
+		ids := []string{}
+		for _, r := range batch {
+			ids = append(ids, r.ID)
+		}
+
+		resp, err := change(ctx, ids)
+		if err != nil && isThrottling(err) {
+			log.Printf("unable to change state of %d instances to %s, throttled: %s", len(batch), state, err)
+			for j := range batch {
+				errs[i+j] = err
+			}
+			continue
+		}
+		if err != nil && len(batch) > 1 {
+			log.Printf("unable to change state of %d instances to %s, retrying one by one: %s", len(batch), state, err)
+			for j := range batch {
+				errs[i+j] = changeInstancesState(ctx, batch[j:j+1], state, change)[0]
+			}
+			continue
+		}
+		if err != nil {
+			log.Printf("[%s] unable to change state to %s: %s", ids[0], state, err)
+			errs[i] = err
+			continue
+		}
+
+		changed := map[string]bool{}
+		for _, c := range resp {
+			changed[aws.ToString(c.InstanceId)] = true
+		}
+		for j, id := range ids {
+			if !changed[id] {
+				log.Printf("[%s] no state change to %s returned", id, state)
+				errs[i+j] = fmt.Errorf("no state change to %s returned", state)
+				continue
+			}
+
+			log.Printf("[%s] state changed to %s", id, state)
+		}
+	}
+
+	return errs
+}
+
+// AWS error codes of a throttled call, the SDK already retried it with backoff
+var throttlingCodes = map[string]bool{
+	"RequestLimitExceeded":  true,
+	"Throttling":            true,
+	"ThrottlingException":   true,
+	"EC2ThrottledException": true,
+}
+
+func isThrottling(err error) bool {
+	var apiErr smithy.APIError
+	return errors.As(err, &apiErr) && throttlingCodes[apiErr.ErrorCode()]
+}
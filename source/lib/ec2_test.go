@@ -0,0 +1,334 @@
+package lib
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/smithy-go"
+	"github.com/stretchr/testify/assert"
+)
+
+var _ EC2TagsAPI = (*mockEC2client)(nil)
+var _ ec2.DescribeInstancesAPIClient = (*mockEC2client)(nil)
+var _ EC2API = (*mockEC2client)(nil)
+var _ Driver = (*EC2Driver)(nil)
+
+type mockEC2client struct {
+	err error
+
+	// DescribeInstances pages, NextToken is the index of the next page
+	pages []*ec2.DescribeInstancesOutput
+	calls int
+
+	tags        []types.Tag
+	deletedTags []types.Tag
+
+	// StartInstances/StopInstances fail for these instances
+	failIDs    map[string]bool
+	startCalls [][]string
+	stopCalls  [][]string
+}
+
+const instanceID = "i-07d023c826d243165"
+
+func (m *mockEC2client) DescribeInstances(ctx context.Context, params *ec2.DescribeInstancesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeInstancesOutput, error) {
+	m.calls++
+	if m.err != nil {
+		return nil, m.err
+	}
+	if len(m.pages) == 0 {
+		return &ec2.DescribeInstancesOutput{}, nil
+	}
+
+	page := 0
+	if params.NextToken != nil {
+		page, _ = strconv.Atoi(*params.NextToken)
+	}
+
+	resp := *m.pages[page]
+	if page+1 < len(m.pages) {
+		resp.NextToken = aws.String(strconv.Itoa(page + 1))
+	}
+
+	return &resp, nil
+}
+
+func (m *mockEC2client) CreateTags(ctx context.Context, params *ec2.CreateTagsInput, optFns ...func(*ec2.Options)) (*ec2.CreateTagsOutput, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+
+	m.tags = append(m.tags, params.Tags...)
+	return &ec2.CreateTagsOutput{}, nil
+}
+
+func (m *mockEC2client) DeleteTags(ctx context.Context, params *ec2.DeleteTagsInput, optFns ...func(*ec2.Options)) (*ec2.DeleteTagsOutput, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+
+	m.deletedTags = append(m.deletedTags, params.Tags...)
+	return &ec2.DeleteTagsOutput{}, nil
+}
+
+func (m *mockEC2client) StartInstances(ctx context.Context, params *ec2.StartInstancesInput, optFns ...func(*ec2.Options)) (*ec2.StartInstancesOutput, error) {
+	m.startCalls = append(m.startCalls, params.InstanceIds)
+	changes, err := m.stateChanges(params.InstanceIds)
+	return &ec2.StartInstancesOutput{StartingInstances: changes}, err
+}
+
+func (m *mockEC2client) StopInstances(ctx context.Context, params *ec2.StopInstancesInput, optFns ...func(*ec2.Options)) (*ec2.StopInstancesOutput, error) {
+	m.stopCalls = append(m.stopCalls, params.InstanceIds)
+	changes, err := m.stateChanges(params.InstanceIds)
+	return &ec2.StopInstancesOutput{StoppingInstances: changes}, err
+}
+
+// a state change per instance, the whole call fails if any instance is in failIDs
+func (m *mockEC2client) stateChanges(ids []string) ([]types.InstanceStateChange, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+
+	changes := []types.InstanceStateChange{}
+	for _, id := range ids {
+		if m.failIDs[id] {
+			return nil, fmt.Errorf("IncorrectInstanceState: %s", id)
+		}
+		changes = append(changes, types.InstanceStateChange{InstanceId: aws.String(id)})
+	}
+
+	return changes, nil
+}
+
+// reservation with one instance per ID
+func reservation(instanceIDs ...string) types.Reservation {
+	r := types.Reservation{}
+	for _, id := range instanceIDs {
+		r.Instances = append(r.Instances, types.Instance{
+			InstanceId: aws.String(id),
+			State:      &types.InstanceState{Name: types.InstanceStateNameRunning},
+		})
+	}
+
+	return r
+}
+
+func TestDescribeInstances(t *testing.T) {
+	tests := []struct {
+		name      string
+		client    *mockEC2client
+		wantIDs   []string
+		wantCalls int
+		err       bool
+	}{
+		{
+			name:      "no instances",
+			client:    &mockEC2client{},
+			wantIDs:   []string{},
+			wantCalls: 1,
+		},
+		{
+			name: "single page",
+			client: &mockEC2client{
+				pages: []*ec2.DescribeInstancesOutput{
+					{Reservations: []types.Reservation{reservation("i-1"), reservation("i-2")}},
+				},
+			},
+			wantIDs:   []string{"i-1", "i-2"},
+			wantCalls: 1,
+		},
+		{
+			name: "multiple pages",
+			client: &mockEC2client{
+				pages: []*ec2.DescribeInstancesOutput{
+					{Reservations: []types.Reservation{reservation("i-1"), reservation("i-2")}},
+					{Reservations: []types.Reservation{reservation("i-3")}},
+					{Reservations: []types.Reservation{reservation("i-4"), reservation("i-5")}},
+				},
+			},
+			wantIDs:   []string{"i-1", "i-2", "i-3", "i-4", "i-5"},
+			wantCalls: 3,
+		},
+		{
+			name: "error",
+			client: &mockEC2client{
+				err: fmt.Errorf("error describing instances"),
+			},
+			wantCalls: 1,
+			err:       true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := DescribeInstances(context.Background(), test.client, &ec2.DescribeInstancesInput{})
+			assert.Equal(t, test.wantCalls, test.client.calls)
+			if test.err {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			ids := []string{}
+			for _, r := range got {
+				for _, instance := range r.Instances {
+					ids = append(ids, *instance.InstanceId)
+				}
+			}
+			assert.Equal(t, test.wantIDs, ids)
+		})
+	}
+}
+
+func TestCreateTags(t *testing.T) {
+	tests := []struct {
+		name   string
+		client *mockEC2client
+		err    bool
+	}{
+		{
+			name:   "create tags",
+			client: &mockEC2client{},
+		},
+		{
+			name: "create tags error",
+			client: &mockEC2client{
+				err: fmt.Errorf("error creating tags"),
+			},
+			err: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := CreateTags(context.Background(), test.client, instanceID, []types.Tag{{Key: aws.String("Schedule"), Value: aws.String("#13:00-14:00")}})
+			if test.err {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, []types.Tag{{Key: aws.String("Schedule"), Value: aws.String("#13:00-14:00")}}, test.client.tags)
+		})
+	}
+}
+
+func TestDeleteTags(t *testing.T) {
+	client := &mockEC2client{}
+	err := DeleteTags(context.Background(), client, instanceID, "ScheduleSuspendUntil", "ScheduleSNS")
+	assert.NoError(t, err)
+	assert.Equal(t, []types.Tag{{Key: aws.String("ScheduleSuspendUntil")}, {Key: aws.String("ScheduleSNS")}}, client.deletedTags)
+
+	err = DeleteTags(context.Background(), &mockEC2client{err: fmt.Errorf("error deleting tags")}, instanceID, "ScheduleSuspendUntil")
+	assert.Error(t, err)
+}
+
+func TestInstanceTags(t *testing.T) {
+	got := InstanceTags(types.Instance{
+		Tags: []types.Tag{
+			{Key: aws.String("Name"), Value: aws.String("web-1")},
+			{Key: aws.String("Schedule"), Value: aws.String("07:00-19:00")},
+		},
+	})
+
+	assert.Equal(t, map[string]string{"Name": "web-1", "Schedule": "07:00-19:00"}, got)
+}
+
+func TestEC2DriverList(t *testing.T) {
+	r := reservation("i-1", "i-2")
+	r.OwnerId = aws.String("123456789012")
+	r.Instances[0].Tags = []types.Tag{{Key: aws.String("Name"), Value: aws.String("web-1")}, {Key: aws.String("Schedule"), Value: aws.String("07:00-19:00")}}
+	r.Instances[1].State.Name = types.InstanceStateNameStopped
+
+	d := NewEC2Driver(&mockEC2client{pages: []*ec2.DescribeInstancesOutput{{Reservations: []types.Reservation{r}}}}, "eu-west-1")
+	got, err := d.List(context.Background(), "Schedule")
+	assert.NoError(t, err)
+	assert.Equal(t, []Resource{
+		{
+			Type:    ResourceTypeInstance,
+			ID:      "i-1",
+			Name:    "web-1",
+			Account: "123456789012",
+			Region:  "eu-west-1",
+			State:   StateRunning,
+			Tags:    map[string]string{"Name": "web-1", "Schedule": "07:00-19:00"},
+		},
+		{
+			Type:    ResourceTypeInstance,
+			ID:      "i-2",
+			Account: "123456789012",
+			Region:  "eu-west-1",
+			State:   StateStopped,
+			Tags:    map[string]string{},
+		},
+	}, got)
+
+	_, err = NewEC2Driver(&mockEC2client{}, "eu-west-1").Get(context.Background(), ResourceTypeInstance, "i-1")
+	assert.Equal(t, ErrNotFound, err)
+}
+
+func TestEC2DriverStopBatches(t *testing.T) {
+	resources := []Resource{}
+	for i := 0; i < 120; i++ {
+		resources = append(resources, Resource{Type: ResourceTypeInstance, ID: fmt.Sprintf("i-%03d", i)})
+	}
+
+	client := &mockEC2client{}
+	errs := NewEC2Driver(client, "eu-west-1").Stop(context.Background(), resources)
+
+	assert.Len(t, client.stopCalls, 3)
+	assert.Len(t, client.stopCalls[0], maxInstancesPerCall)
+	assert.Len(t, client.stopCalls[2], 20)
+	assert.Len(t, errs, 120)
+	for i, err := range errs {
+		assert.NoError(t, err, resources[i].ID)
+	}
+}
+
+func TestEC2DriverPartialFailure(t *testing.T) {
+	resources := []Resource{{ID: "i-1"}, {ID: "i-2"}, {ID: "i-3"}}
+
+	client := &mockEC2client{failIDs: map[string]bool{"i-2": true}}
+	errs := NewEC2Driver(client, "eu-west-1").Start(context.Background(), resources)
+
+	// failed batch, then one call per instance
+	assert.Equal(t, [][]string{{"i-1", "i-2", "i-3"}, {"i-1"}, {"i-2"}, {"i-3"}}, client.startCalls)
+	assert.NoError(t, errs[0])
+	assert.Error(t, errs[1])
+	assert.NoError(t, errs[2])
+
+	errs = NewEC2Driver(&mockEC2client{err: fmt.Errorf("UnauthorizedOperation")}, "eu-west-1").Stop(context.Background(), resources[:1])
+	assert.EqualError(t, errs[0], "UnauthorizedOperation")
+}
+
+func TestEC2DriverThrottling(t *testing.T) {
+	resources := []Resource{{ID: "i-1"}, {ID: "i-2"}, {ID: "i-3"}}
+
+	// a throttled batch isn't retried one by one, every instance gets the error
+	client := &mockEC2client{err: &smithy.GenericAPIError{Code: "RequestLimitExceeded"}}
+	errs := NewEC2Driver(client, "eu-west-1").Start(context.Background(), resources)
+
+	assert.Equal(t, [][]string{{"i-1", "i-2", "i-3"}}, client.startCalls)
+	for _, err := range errs {
+		assert.Equal(t, client.err, err)
+	}
+}
+
+func TestEC2DriverTags(t *testing.T) {
+	client := &mockEC2client{}
+	d := NewEC2Driver(client, "eu-west-1")
+
+	assert.NoError(t, d.CreateTags(context.Background(), Resource{ID: instanceID}, map[string]string{"Schedule": "#07:00-19:00", "ScheduleDisabledBy": "ec2scheduler"}))
+	assert.Equal(t, []types.Tag{
+		{Key: aws.String("Schedule"), Value: aws.String("#07:00-19:00")},
+		{Key: aws.String("ScheduleDisabledBy"), Value: aws.String("ec2scheduler")},
+	}, client.tags)
+
+	assert.NoError(t, d.DeleteTags(context.Background(), Resource{ID: instanceID}, "ScheduleSuspendUntil"))
+	assert.Equal(t, []types.Tag{{Key: aws.String("ScheduleSuspendUntil")}}, client.deletedTags)
+}
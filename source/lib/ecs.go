@@ -0,0 +1,234 @@
+package lib
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	ecstypes "github.com/aws/aws-sdk-go-v2/service/ecs/types"
+)
+
+// services per DescribeServices call
+const maxServicesPerCall = 10
+
+// ECS calls of the service driver, *ecs.Client implements it
+type ECSAPI interface {
+	ecs.ListClustersAPIClient
+	ecs.ListServicesAPIClient
+	DescribeServices(ctx context.Context, params *ecs.DescribeServicesInput, optFns ...func(*ecs.Options)) (*ecs.DescribeServicesOutput, error)
+	UpdateService(ctx context.Context, params *ecs.UpdateServiceInput, optFns ...func(*ecs.Options)) (*ecs.UpdateServiceOutput, error)
+	TagResource(ctx context.Context, params *ecs.TagResourceInput, optFns ...func(*ecs.Options)) (*ecs.TagResourceOutput, error)
+	UntagResource(ctx context.Context, params *ecs.UntagResourceInput, optFns ...func(*ecs.Options)) (*ecs.UntagResourceOutput, error)
+}
+
+// ECSDriver schedules the ECS services of a region, setting their desired count to zero and back
+// a service is running while its desired count isn't zero, its id is cluster/service
+type ECSDriver struct {
+	client ECSAPI
+	region string
+	// tag saving the desired count of a service set to zero (scheduleTagCapacity), desired=2
+	capacityTag string
+}
+
+func NewECSDriver(client ECSAPI, region, capacityTag string) *ECSDriver {
+	return &ECSDriver{client: client, region: region, capacityTag: capacityTag}
+}
+
+func (d *ECSDriver) Types() []string {
+	return []string{ResourceTypeECSService}
+}
+
+// services of every cluster, ListServices can't filter on tags
+func (d *ECSDriver) List(ctx context.Context, tagKey string) ([]Resource, error) {
+	resources := []Resource{}
+	clusters := ecs.NewListClustersPaginator(d.client, &ecs.ListClustersInput{})
+	for clusters.HasMorePages() {
+		resp, err := clusters.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, cluster := range resp.ClusterArns {
+			arns := []string{}
+			services := ecs.NewListServicesPaginator(d.client, &ecs.ListServicesInput{Cluster: aws.String(cluster)})
+			for services.HasMorePages() {
+				resp, err := services.NextPage(ctx)
+				if err != nil {
+					return nil, err
+				}
+				arns = append(arns, resp.ServiceArns...)
+			}
+
+			described, err := d.describe(ctx, cluster, arns)
+			if err != nil {
+				return nil, err
+			}
+			for _, r := range described {
+				if _, ok := r.Tags[tagKey]; ok {
+					resources = append(resources, r)
+				}
+			}
+		}
+	}
+
+	return resources, nil
+}
+
+func (d *ECSDriver) Get(ctx context.Context, resourceType, id string) (Resource, error) {
+	parts := strings.SplitN(id, "/", 2)
+	if len(parts) != 2 {
+		return Resource{}, fmt.Errorf("invalid service %s, expected cluster/service", id)
+	}
+
+	resources, err := d.describe(ctx, parts[0], []string{parts[1]})
+	if err != nil {
+		return Resource{}, err
+	}
+	if len(resources) < 1 {
+		return Resource{}, ErrNotFound
+	}
+
+	return resources[0], nil
+}
+
+// active services of cluster, in batches of maxServicesPerCall
+func (d *ECSDriver) describe(ctx context.Context, cluster string, services []string) ([]Resource, error) {
+	described, err := d.describeServices(ctx, cluster, services)
+	if err != nil {
+		return nil, err
+	}
+
+	resources := []Resource{}
+	for _, service := range described {
+		resources = append(resources, d.resource(service))
+	}
+
+	return resources, nil
+}
+
+func (d *ECSDriver) describeServices(ctx context.Context, cluster string, services []string) ([]ecstypes.Service, error) {
+	described := []ecstypes.Service{}
+	for i := 0; i < len(services); i += maxServicesPerCall {
+		end := i + maxServicesPerCall
+		if end > len(services) {
+			end = len(services)
+		}
+
+		resp, err := d.client.DescribeServices(ctx, &ecs.DescribeServicesInput{
+			Cluster:  aws.String(cluster),
+			Services: services[i:end],
+			Include:  []ecstypes.ServiceField{ecstypes.ServiceFieldTags},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, service := range resp.Services {
+			if aws.ToString(service.Status) == "ACTIVE" {
+				described = append(described, service)
+			}
+		}
+	}
+
+	return described, nil
+}
+
+func (d *ECSDriver) resource(service ecstypes.Service) Resource {
+	// arn:aws:ecs:<region>:<account>:cluster/<name>
+	cluster := aws.ToString(service.ClusterArn)
+	cluster = cluster[strings.LastIndex(cluster, "/")+1:]
+	id := cluster + "/" + aws.ToString(service.ServiceName)
+
+	state := StateRunning
+	if service.DesiredCount == 0 {
+		state = StateStopped
+	}
+
+	tags := map[string]string{}
+	for _, tag := range service.Tags {
+		tags[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+	}
+
+	return Resource{
+		Type:    ResourceTypeECSService,
+		ID:      id,
+		Name:    aws.ToString(service.ServiceName),
+		ARN:     aws.ToString(service.ServiceArn),
+		Account: arnAccount(aws.ToString(service.ServiceArn)),
+		Region:  d.region,
+		State:   state,
+		Tags:    tags,
+	}
+}
+
+// restore the desired count saved in the capacity tag, then delete the tag
+// a service set to zero outside of the scheduler has nothing to restore, ErrUnchanged
+func (d *ECSDriver) Start(ctx context.Context, resources []Resource) []error {
+	return startScaled(ctx, d, d.capacityTag, resources)
+}
+
+// save the desired count in the capacity tag, then set it to zero
+func (d *ECSDriver) Stop(ctx context.Context, resources []Resource) []error {
+	return stopScaled(ctx, d, d.capacityTag, resources)
+}
+
+func (d *ECSDriver) capacity(ctx context.Context, r Resource) (string, error) {
+	parts := strings.SplitN(r.ID, "/", 2)
+	if len(parts) != 2 {
+		return "", fmt.Errorf("invalid service %s, expected cluster/service", r.ID)
+	}
+
+	services, err := d.describeServices(ctx, parts[0], []string{parts[1]})
+	if err != nil {
+		return "", err
+	}
+	if len(services) < 1 {
+		return "", ErrNotFound
+	}
+
+	return fmt.Sprintf("desired=%d", services[0].DesiredCount), nil
+}
+
+func (d *ECSDriver) scale(ctx context.Context, r Resource, saved string) error {
+	var desired int32
+	if saved != "" {
+		if _, err := fmt.Sscanf(saved, "desired=%d", &desired); err != nil {
+			return fmt.Errorf("%w %s, expected desired=2", errInvalidCapacity, saved)
+		}
+	}
+
+	parts := strings.SplitN(r.ID, "/", 2)
+	if len(parts) != 2 {
+		return fmt.Errorf("invalid service %s, expected cluster/service", r.ID)
+	}
+
+	_, err := d.client.UpdateService(ctx, &ecs.UpdateServiceInput{
+		Cluster:      aws.String(parts[0]),
+		Service:      aws.String(parts[1]),
+		DesiredCount: aws.Int32(desired),
+	})
+	return err
+}
+
+func (d *ECSDriver) CreateTags(ctx context.Context, resource Resource, tags map[string]string) error {
+	ecsTags := []ecstypes.Tag{}
+	for _, k := range sortedKeys(tags) {
+		ecsTags = append(ecsTags, ecstypes.Tag{Key: aws.String(k), Value: aws.String(tags[k])})
+	}
+
+	_, err := d.client.TagResource(ctx, &ecs.TagResourceInput{
+		ResourceArn: aws.String(resource.ARN),
+		Tags:        ecsTags,
+	})
+	return err
+}
+
+func (d *ECSDriver) DeleteTags(ctx context.Context, resource Resource, keys ...string) error {
+	_, err := d.client.UntagResource(ctx, &ecs.UntagResourceInput{
+		ResourceArn: aws.String(resource.ARN),
+		TagKeys:     keys,
+	})
+	return err
+}
@@ -0,0 +1,185 @@
+package lib
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	ecstypes "github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/stretchr/testify/assert"
+)
+
+var _ ECSAPI = (*mockECSClient)(nil)
+var _ Driver = (*ECSDriver)(nil)
+var _ capacityScaler = (*ECSDriver)(nil)
+
+type mockECSClient struct {
+	err error
+	// services by cluster Arn
+	services map[string][]ecstypes.Service
+
+	updates     []*ecs.UpdateServiceInput
+	tags        []ecstypes.Tag
+	removedTags []string
+}
+
+func (m *mockECSClient) ListClusters(ctx context.Context, params *ecs.ListClustersInput, optFns ...func(*ecs.Options)) (*ecs.ListClustersOutput, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+
+	arns := []string{}
+	for arn := range m.services {
+		arns = append(arns, arn)
+	}
+
+	return &ecs.ListClustersOutput{ClusterArns: arns}, nil
+}
+
+func (m *mockECSClient) ListServices(ctx context.Context, params *ecs.ListServicesInput, optFns ...func(*ecs.Options)) (*ecs.ListServicesOutput, error) {
+	arns := []string{}
+	for _, service := range m.services[aws.ToString(params.Cluster)] {
+		arns = append(arns, aws.ToString(service.ServiceArn))
+	}
+
+	return &ecs.ListServicesOutput{ServiceArns: arns}, m.err
+}
+
+// services of the cluster, by Arn or by name
+func (m *mockECSClient) DescribeServices(ctx context.Context, params *ecs.DescribeServicesInput, optFns ...func(*ecs.Options)) (*ecs.DescribeServicesOutput, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+
+	services := []ecstypes.Service{}
+	for arn, clusterServices := range m.services {
+		if arn != aws.ToString(params.Cluster) && !strings.HasSuffix(arn, "/"+aws.ToString(params.Cluster)) {
+			continue
+		}
+		for _, service := range clusterServices {
+			for _, s := range params.Services {
+				if s == aws.ToString(service.ServiceArn) || s == aws.ToString(service.ServiceName) {
+					services = append(services, service)
+				}
+			}
+		}
+	}
+
+	return &ecs.DescribeServicesOutput{Services: services}, nil
+}
+
+func (m *mockECSClient) UpdateService(ctx context.Context, params *ecs.UpdateServiceInput, optFns ...func(*ecs.Options)) (*ecs.UpdateServiceOutput, error) {
+	m.updates = append(m.updates, params)
+	return &ecs.UpdateServiceOutput{}, m.err
+}
+
+func (m *mockECSClient) TagResource(ctx context.Context, params *ecs.TagResourceInput, optFns ...func(*ecs.Options)) (*ecs.TagResourceOutput, error) {
+	m.tags = append(m.tags, params.Tags...)
+	return &ecs.TagResourceOutput{}, m.err
+}
+
+func (m *mockECSClient) UntagResource(ctx context.Context, params *ecs.UntagResourceInput, optFns ...func(*ecs.Options)) (*ecs.UntagResourceOutput, error) {
+	m.removedTags = append(m.removedTags, params.TagKeys...)
+	return &ecs.UntagResourceOutput{}, m.err
+}
+
+func TestECSDriverList(t *testing.T) {
+	d := NewECSDriver(&mockECSClient{services: map[string][]ecstypes.Service{
+		"arn:aws:ecs:eu-west-1:123456789012:cluster/apps": {
+			{
+				ClusterArn:   aws.String("arn:aws:ecs:eu-west-1:123456789012:cluster/apps"),
+				ServiceArn:   aws.String("arn:aws:ecs:eu-west-1:123456789012:service/apps/api"),
+				ServiceName:  aws.String("api"),
+				Status:       aws.String("ACTIVE"),
+				DesiredCount: 2,
+				Tags:         []ecstypes.Tag{{Key: aws.String("Schedule"), Value: aws.String("07:00-19:00")}},
+			},
+			{
+				ClusterArn:   aws.String("arn:aws:ecs:eu-west-1:123456789012:cluster/apps"),
+				ServiceArn:   aws.String("arn:aws:ecs:eu-west-1:123456789012:service/apps/worker"),
+				ServiceName:  aws.String("worker"),
+				Status:       aws.String("ACTIVE"),
+				DesiredCount: 0,
+				Tags: []ecstypes.Tag{
+					{Key: aws.String("Schedule"), Value: aws.String("07:00-19:00")},
+					{Key: aws.String("ScheduleCapacity"), Value: aws.String("desired=3")},
+				},
+			},
+			{
+				ClusterArn:   aws.String("arn:aws:ecs:eu-west-1:123456789012:cluster/apps"),
+				ServiceArn:   aws.String("arn:aws:ecs:eu-west-1:123456789012:service/apps/unscheduled"),
+				ServiceName:  aws.String("unscheduled"),
+				Status:       aws.String("ACTIVE"),
+				DesiredCount: 1,
+			},
+			{
+				ClusterArn:   aws.String("arn:aws:ecs:eu-west-1:123456789012:cluster/apps"),
+				ServiceArn:   aws.String("arn:aws:ecs:eu-west-1:123456789012:service/apps/old"),
+				ServiceName:  aws.String("old"),
+				Status:       aws.String("DRAINING"),
+				DesiredCount: 1,
+				Tags:         []ecstypes.Tag{{Key: aws.String("Schedule"), Value: aws.String("07:00-19:00")}},
+			},
+		},
+	}}, "eu-west-1", "ScheduleCapacity")
+
+	got, err := d.List(context.Background(), "Schedule")
+	assert.NoError(t, err)
+	assert.Len(t, got, 2)
+	assert.Equal(t, Resource{
+		Type:    ResourceTypeECSService,
+		ID:      "apps/api",
+		Name:    "api",
+		ARN:     "arn:aws:ecs:eu-west-1:123456789012:service/apps/api",
+		Account: "123456789012",
+		Region:  "eu-west-1",
+		State:   StateRunning,
+		Tags:    map[string]string{"Schedule": "07:00-19:00"},
+	}, got[0])
+	assert.Equal(t, StateStopped, got[1].State)
+
+	r, err := d.Get(context.Background(), ResourceTypeECSService, "apps/worker")
+	assert.NoError(t, err)
+	assert.Equal(t, "worker", r.Name)
+
+	_, err = d.Get(context.Background(), ResourceTypeECSService, "apps/missing")
+	assert.Equal(t, ErrNotFound, err)
+	_, err = d.Get(context.Background(), ResourceTypeECSService, "api")
+	assert.Error(t, err)
+}
+
+func TestECSDriverStartStop(t *testing.T) {
+	client := &mockECSClient{services: map[string][]ecstypes.Service{
+		"arn:aws:ecs:eu-west-1:123456789012:cluster/apps": {
+			{ServiceName: aws.String("api"), Status: aws.String("ACTIVE"), DesiredCount: 2},
+		},
+	}}
+	d := NewECSDriver(client, "eu-west-1", "ScheduleCapacity")
+
+	errs := d.Stop(context.Background(), []Resource{{ID: "apps/api", ARN: "arn:aws:ecs:eu-west-1:123456789012:service/apps/api"}})
+	assert.Equal(t, []error{nil}, errs)
+
+	// desired count saved before setting it to zero
+	assert.Equal(t, []ecstypes.Tag{{Key: aws.String("ScheduleCapacity"), Value: aws.String("desired=2")}}, client.tags)
+
+	errs = d.Start(context.Background(), []Resource{
+		{ID: "apps/worker", Tags: map[string]string{"ScheduleCapacity": "desired=3"}},
+		// set to zero by hand
+		{ID: "apps/manual", Tags: map[string]string{}},
+	})
+	assert.Equal(t, []error{nil, ErrUnchanged}, errs)
+	assert.Equal(t, []*ecs.UpdateServiceInput{
+		{Cluster: aws.String("apps"), Service: aws.String("api"), DesiredCount: aws.Int32(0)},
+		{Cluster: aws.String("apps"), Service: aws.String("worker"), DesiredCount: aws.Int32(3)},
+	}, client.updates)
+	assert.Equal(t, []string{"ScheduleCapacity"}, client.removedTags)
+
+	// not set to zero if the desired count can't be saved
+	client = &mockECSClient{err: fmt.Errorf("AccessDeniedException")}
+	errs = NewECSDriver(client, "eu-west-1", "ScheduleCapacity").Stop(context.Background(), []Resource{{ID: "apps/api"}})
+	assert.EqualError(t, errs[0], "AccessDeniedException")
+	assert.Empty(t, client.updates)
+}
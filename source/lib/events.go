@@ -0,0 +1,143 @@
+package lib
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+)
+
+// source of the events put on the EventBridge bus
+const EventSource = "ec2scheduler"
+
+// event detail types
+const (
+	EventInstanceStarted     = "InstanceStarted"
+	EventInstanceStopped     = "InstanceStopped"
+	EventScheduleSet         = "ScheduleSet"
+	EventScheduleInvalid     = "ScheduleInvalid"
+	EventScheduleSuspended   = "ScheduleSuspended"
+	EventScheduleUnsuspended = "ScheduleUnsuspended"
+	EventScheduleDisabled    = "ScheduleDisabled"
+	EventScheduleEnabled     = "ScheduleEnabled"
+)
+
+// entries per PutEvents call
+const maxEventsPerCall = 10
+
+// EventBridge bus the scheduler events are put on, no events are sent if empty
+type EventConfig struct {
+	EventBus string `env:"EVENT_BUS"`
+}
+
+// EventBridge calls to put events, *eventbridge.Client implements it
+type EventBridgeAPI interface {
+	PutEvents(ctx context.Context, params *eventbridge.PutEventsInput, optFns ...func(*eventbridge.Options)) (*eventbridge.PutEventsOutput, error)
+}
+
+// scheduler event, DetailType is one of the Event* constants
+type Event struct {
+	DetailType string
+	Detail     EventDetail
+	Time       time.Time
+}
+
+// event detail, only the fields relevant to the detail type are set
+type EventDetail struct {
+	// resource type, see the ResourceType* constants
+	Type          string `json:"type,omitempty"`
+	InstanceID    string `json:"instanceId"`
+	InstanceName  string `json:"instanceName,omitempty"`
+	Account       string `json:"account,omitempty"`
+	Region        string `json:"region,omitempty"`
+	Schedule      string `json:"schedule,omitempty"`
+	PreviousState string `json:"previousState,omitempty"`
+	State         string `json:"state,omitempty"`
+	Reason        string `json:"reason,omitempty"`
+	SuspendUntil  string `json:"suspendUntil,omitempty"`
+	SuspendMode   string `json:"suspendMode,omitempty"`
+	User          string `json:"user,omitempty"`
+	Error         string `json:"error,omitempty"`
+}
+
+// EventPublisher puts events on an EventBridge bus
+// a nil publisher, or one without bus, drops them
+type EventPublisher struct {
+	client EventBridgeAPI
+	bus    string
+}
+
+func NewEventPublisher(client EventBridgeAPI, bus string) *EventPublisher {
+	return &EventPublisher{client: client, bus: bus}
+}
+
+// new event of detailType, now
+func NewEvent(detailType string, detail EventDetail) Event {
+	return Event{DetailType: detailType, Detail: detail, Time: time.Now()}
+}
+
+// put events on the bus, in batches of maxEventsPerCall
+// every batch is tried, the first error is returned
+func (p *EventPublisher) Put(ctx context.Context, events ...Event) error {
+	if p == nil || p.bus == "" || len(events) == 0 {
+		return nil
+	}
+
+	var firstErr error
+	for i := 0; i < len(events); i += maxEventsPerCall {
+		end := i + maxEventsPerCall
+		if end > len(events) {
+			end = len(events)
+		}
+
+		if err := p.put(ctx, events[i:end]); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
+
+func (p *EventPublisher) put(ctx context.Context, events []Event) error {
+	entries := []types.PutEventsRequestEntry{}
+	for _, event := range events {
+		detail, err := json.Marshal(event.Detail)
+		if err != nil {
+			return err
+		}
+
+		entries = append(entries, types.PutEventsRequestEntry{
+			EventBusName: aws.String(p.bus),
+			Source:       aws.String(EventSource),
+			DetailType:   aws.String(event.DetailType),
+			Detail:       aws.String(string(detail)),
+			Time:         aws.Time(event.Time),
+		})
+	}
+
+	resp, err := p.client.PutEvents(ctx, &eventbridge.PutEventsInput{
+		Entries: entries,
+	})
+	if err != nil {
+		return err
+	}
+
+	// entries fail one by one, in the same order as the request
+	if resp.FailedEntryCount > 0 {
+		for i, entry := range resp.Entries {
+			if entry.ErrorCode != nil {
+				return fmt.Errorf("unable to put %s event of %s: %s %s", events[i].DetailType, events[i].Detail.InstanceID,
+					aws.ToString(entry.ErrorCode), aws.ToString(entry.ErrorMessage))
+			}
+		}
+		return fmt.Errorf("unable to put %d events", resp.FailedEntryCount)
+	}
+
+	log.Printf("%d events put on %s", len(events), p.bus)
+	return nil
+}
@@ -0,0 +1,111 @@
+package lib
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+	"github.com/stretchr/testify/assert"
+)
+
+var _ EventBridgeAPI = (*mockEventBridgeClient)(nil)
+
+type mockEventBridgeClient struct {
+	err error
+	// entries of this detail type fail
+	failDetailType string
+	calls          [][]types.PutEventsRequestEntry
+}
+
+func (m *mockEventBridgeClient) PutEvents(ctx context.Context, params *eventbridge.PutEventsInput, optFns ...func(*eventbridge.Options)) (*eventbridge.PutEventsOutput, error) {
+	m.calls = append(m.calls, params.Entries)
+	if m.err != nil {
+		return nil, m.err
+	}
+
+	resp := &eventbridge.PutEventsOutput{}
+	for _, entry := range params.Entries {
+		if aws.ToString(entry.DetailType) == m.failDetailType {
+			resp.FailedEntryCount++
+			resp.Entries = append(resp.Entries, types.PutEventsResultEntry{
+				ErrorCode:    aws.String("InternalFailure"),
+				ErrorMessage: aws.String("internal failure"),
+			})
+			continue
+		}
+		resp.Entries = append(resp.Entries, types.PutEventsResultEntry{EventId: aws.String("id")})
+	}
+
+	return resp, nil
+}
+
+func TestEventPublisherPut(t *testing.T) {
+	now := time.Date(2021, 01, 11, 7, 02, 00, 00, time.UTC)
+	client := &mockEventBridgeClient{}
+	publisher := NewEventPublisher(client, "ec2scheduler")
+
+	err := publisher.Put(context.Background(), Event{
+		DetailType: EventInstanceStarted,
+		Detail: EventDetail{
+			InstanceID:    instanceID,
+			Schedule:      "07:00-19:00",
+			PreviousState: "stopped",
+			State:         "running",
+			Reason:        "inside time window 07:00-19:00",
+		},
+		Time: now,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, [][]types.PutEventsRequestEntry{
+		{
+			{
+				EventBusName: aws.String("ec2scheduler"),
+				Source:       aws.String("ec2scheduler"),
+				DetailType:   aws.String("InstanceStarted"),
+				Detail:       aws.String(`{"instanceId":"i-07d023c826d243165","schedule":"07:00-19:00","previousState":"stopped","state":"running","reason":"inside time window 07:00-19:00"}`),
+				Time:         aws.Time(now),
+			},
+		},
+	}, client.calls)
+}
+
+func TestEventPublisherBatches(t *testing.T) {
+	events := []Event{}
+	for i := 0; i < 23; i++ {
+		events = append(events, NewEvent(EventInstanceStopped, EventDetail{InstanceID: fmt.Sprintf("i-%d", i)}))
+	}
+
+	client := &mockEventBridgeClient{}
+	assert.NoError(t, NewEventPublisher(client, "default").Put(context.Background(), events...))
+	assert.Len(t, client.calls, 3)
+	assert.Len(t, client.calls[0], 10)
+	assert.Len(t, client.calls[2], 3)
+}
+
+func TestEventPublisherDisabled(t *testing.T) {
+	event := NewEvent(EventScheduleSet, EventDetail{InstanceID: instanceID})
+
+	var publisher *EventPublisher
+	assert.NoError(t, publisher.Put(context.Background(), event))
+
+	client := &mockEventBridgeClient{}
+	assert.NoError(t, NewEventPublisher(client, "").Put(context.Background(), event))
+	assert.Len(t, client.calls, 0)
+}
+
+func TestEventPublisherErrors(t *testing.T) {
+	events := []Event{
+		NewEvent(EventScheduleSet, EventDetail{InstanceID: "i-1"}),
+		NewEvent(EventScheduleInvalid, EventDetail{InstanceID: "i-2", Error: "invalid time window"}),
+	}
+
+	err := NewEventPublisher(&mockEventBridgeClient{failDetailType: EventScheduleInvalid}, "default").Put(context.Background(), events...)
+	assert.EqualError(t, err, "unable to put ScheduleInvalid event of i-2: InternalFailure internal failure")
+
+	err = NewEventPublisher(&mockEventBridgeClient{err: fmt.Errorf("AccessDenied")}, "default").Put(context.Background(), events...)
+	assert.Error(t, err)
+}
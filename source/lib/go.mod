@@ -0,0 +1,19 @@
+module github.com/dwtechnologies/ec2scheduler/source/lib
+
+go 1.15
+
+require (
+	github.com/aws/aws-sdk-go-v2 v1.1.0
+	github.com/aws/aws-sdk-go-v2/credentials v1.1.0
+	github.com/aws/aws-sdk-go-v2/service/autoscaling v1.1.0
+	github.com/aws/aws-sdk-go-v2/service/ec2 v1.1.0
+	github.com/aws/aws-sdk-go-v2/service/ecs v1.1.0
+	github.com/aws/aws-sdk-go-v2/service/eventbridge v1.1.0
+	github.com/aws/aws-sdk-go-v2/service/organizations v1.0.0
+	github.com/aws/aws-sdk-go-v2/service/rds v1.1.0
+	github.com/aws/aws-sdk-go-v2/service/s3 v1.1.0
+	github.com/aws/aws-sdk-go-v2/service/ssm v1.1.0
+	github.com/aws/aws-sdk-go-v2/service/sts v1.1.0
+	github.com/aws/smithy-go v1.0.0
+	github.com/stretchr/testify v1.7.0
+)
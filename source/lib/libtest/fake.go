@@ -0,0 +1,192 @@
+// Package libtest provides an in-memory lib.Driver for the tests of the functions
+package libtest
+
+import (
+	"context"
+	"sync"
+
+	"github.com/dwtechnologies/ec2scheduler/source/lib"
+)
+
+// FakeDriver is an in-memory lib.Driver
+// Start/Stop change the state of its Resources, CreateTags/DeleteTags their tags
+type FakeDriver struct {
+	mu sync.Mutex
+
+	Resources []lib.Resource
+	// every call fails with Err
+	Err error
+	// Start/Stop fail for these resource ids
+	Fail map[string]error
+
+	// ids of the started and stopped resources
+	Started []string
+	Stopped []string
+}
+
+func NewFakeDriver(resources ...lib.Resource) *FakeDriver {
+	return &FakeDriver{Resources: resources}
+}
+
+// types of its resources
+func (d *FakeDriver) Types() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	types := []string{}
+	seen := map[string]bool{}
+	for _, r := range d.Resources {
+		if !seen[r.Type] {
+			seen[r.Type] = true
+			types = append(types, r.Type)
+		}
+	}
+
+	return types
+}
+
+func (d *FakeDriver) List(ctx context.Context, tagKey string) ([]lib.Resource, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.Err != nil {
+		return nil, d.Err
+	}
+
+	resources := []lib.Resource{}
+	for _, r := range d.Resources {
+		if _, ok := r.Tags[tagKey]; ok && (r.State == lib.StateRunning || r.State == lib.StateStopped) {
+			resources = append(resources, copyResource(r))
+		}
+	}
+
+	return resources, nil
+}
+
+func (d *FakeDriver) Get(ctx context.Context, resourceType, id string) (lib.Resource, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.Err != nil {
+		return lib.Resource{}, d.Err
+	}
+
+	if i := d.find(lib.Resource{Type: resourceType, ID: id}); i >= 0 {
+		return copyResource(d.Resources[i]), nil
+	}
+
+	return lib.Resource{}, lib.ErrNotFound
+}
+
+func (d *FakeDriver) Start(ctx context.Context, resources []lib.Resource) []error {
+	return d.change(resources, lib.StateRunning)
+}
+
+func (d *FakeDriver) Stop(ctx context.Context, resources []lib.Resource) []error {
+	return d.change(resources, lib.StateStopped)
+}
+
+func (d *FakeDriver) change(resources []lib.Resource, state lib.State) []error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	errs := make([]error, len(resources))
+	for i, r := range resources {
+		if d.Err != nil {
+			errs[i] = d.Err
+			continue
+		}
+		if err := d.Fail[r.ID]; err != nil {
+			errs[i] = err
+			continue
+		}
+
+		if j := d.find(r); j >= 0 {
+			d.Resources[j].State = state
+		}
+		if state == lib.StateRunning {
+			d.Started = append(d.Started, r.ID)
+		} else {
+			d.Stopped = append(d.Stopped, r.ID)
+		}
+	}
+
+	return errs
+}
+
+func (d *FakeDriver) CreateTags(ctx context.Context, resource lib.Resource, tags map[string]string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.Err != nil {
+		return d.Err
+	}
+
+	i := d.find(resource)
+	if i < 0 {
+		return lib.ErrNotFound
+	}
+	if d.Resources[i].Tags == nil {
+		d.Resources[i].Tags = map[string]string{}
+	}
+	for k, v := range tags {
+		d.Resources[i].Tags[k] = v
+	}
+
+	return nil
+}
+
+func (d *FakeDriver) DeleteTags(ctx context.Context, resource lib.Resource, keys ...string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.Err != nil {
+		return d.Err
+	}
+
+	i := d.find(resource)
+	if i < 0 {
+		return lib.ErrNotFound
+	}
+	for _, k := range keys {
+		delete(d.Resources[i].Tags, k)
+	}
+
+	return nil
+}
+
+// tags of the resource of id, nil if there is none
+func (d *FakeDriver) Tags(id string) map[string]string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, r := range d.Resources {
+		if r.ID == id {
+			return copyResource(r).Tags
+		}
+	}
+
+	return nil
+}
+
+// index of the resource of the same type and id, -1 if there is none
+func (d *FakeDriver) find(resource lib.Resource) int {
+	for i, r := range d.Resources {
+		if r.Type == resource.Type && r.ID == resource.ID {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// resource with its own tags, callers can't change the driver ones
+func copyResource(r lib.Resource) lib.Resource {
+	tags := map[string]string{}
+	for k, v := range r.Tags {
+		tags[k] = v
+	}
+	r.Tags = tags
+
+	return r
+}
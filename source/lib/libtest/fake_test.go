@@ -0,0 +1,49 @@
+package libtest
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/dwtechnologies/ec2scheduler/source/lib"
+	"github.com/stretchr/testify/assert"
+)
+
+var _ lib.Driver = (*FakeDriver)(nil)
+
+func TestFakeDriver(t *testing.T) {
+	d := NewFakeDriver(
+		lib.Resource{Type: lib.ResourceTypeInstance, ID: "i-1", State: lib.StateStopped, Tags: map[string]string{"Schedule": "07:00-19:00"}},
+		lib.Resource{Type: lib.ResourceTypeInstance, ID: "i-2", State: lib.StateRunning, Tags: map[string]string{"Schedule": "07:00-19:00"}},
+		lib.Resource{Type: lib.ResourceTypeInstance, ID: "i-3", State: "pending", Tags: map[string]string{"Schedule": "07:00-19:00"}},
+		lib.Resource{Type: lib.ResourceTypeInstance, ID: "i-4", State: lib.StateRunning},
+	)
+	d.Fail = map[string]error{"i-2": fmt.Errorf("IncorrectInstanceState")}
+
+	// scheduled resources, running or stopped
+	list, err := d.List(context.Background(), "Schedule")
+	assert.NoError(t, err)
+	assert.Len(t, list, 2)
+
+	r, err := d.Get(context.Background(), lib.ResourceTypeInstance, "i-1")
+	assert.NoError(t, err)
+	_, err = d.Get(context.Background(), lib.ResourceTypeInstance, "i-5")
+	assert.Equal(t, lib.ErrNotFound, err)
+
+	errs := d.Start(context.Background(), []lib.Resource{r})
+	assert.Equal(t, []error{nil}, errs)
+	errs = d.Stop(context.Background(), []lib.Resource{{Type: lib.ResourceTypeInstance, ID: "i-2"}})
+	assert.Error(t, errs[0])
+	assert.Equal(t, []string{"i-1"}, d.Started)
+	assert.Empty(t, d.Stopped)
+
+	r, _ = d.Get(context.Background(), lib.ResourceTypeInstance, "i-1")
+	assert.Equal(t, lib.StateRunning, r.State)
+
+	// callers get copies of the tags
+	r.Tags["Schedule"] = "#07:00-19:00"
+	assert.NoError(t, d.CreateTags(context.Background(), r, map[string]string{"ScheduleSuspendUntil": "20210111T08:00"}))
+	assert.NoError(t, d.DeleteTags(context.Background(), r, "Schedule"))
+	assert.Equal(t, map[string]string{"ScheduleSuspendUntil": "20210111T08:00"}, d.Tags("i-1"))
+	assert.Equal(t, []string{lib.ResourceTypeInstance}, d.Types())
+}
@@ -0,0 +1,243 @@
+package lib
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/rds"
+	rdstypes "github.com/aws/aws-sdk-go-v2/service/rds/types"
+	"github.com/aws/smithy-go"
+)
+
+// RDS starts again a database stopped for this long
+const RDSMaxStopped = 7 * 24 * time.Hour
+
+// RDS statuses mapped to running/stopped, the others (starting, backing-up, ...) are kept as they are
+const (
+	rdsStatusAvailable = "available"
+	rdsStatusStopped   = "stopped"
+)
+
+// RDS calls of the database driver, *rds.Client implements it
+type RDSAPI interface {
+	rds.DescribeDBInstancesAPIClient
+	rds.DescribeDBClustersAPIClient
+	StartDBInstance(ctx context.Context, params *rds.StartDBInstanceInput, optFns ...func(*rds.Options)) (*rds.StartDBInstanceOutput, error)
+	StopDBInstance(ctx context.Context, params *rds.StopDBInstanceInput, optFns ...func(*rds.Options)) (*rds.StopDBInstanceOutput, error)
+	StartDBCluster(ctx context.Context, params *rds.StartDBClusterInput, optFns ...func(*rds.Options)) (*rds.StartDBClusterOutput, error)
+	StopDBCluster(ctx context.Context, params *rds.StopDBClusterInput, optFns ...func(*rds.Options)) (*rds.StopDBClusterOutput, error)
+	AddTagsToResource(ctx context.Context, params *rds.AddTagsToResourceInput, optFns ...func(*rds.Options)) (*rds.AddTagsToResourceOutput, error)
+	RemoveTagsFromResource(ctx context.Context, params *rds.RemoveTagsFromResourceInput, optFns ...func(*rds.Options)) (*rds.RemoveTagsFromResourceOutput, error)
+}
+
+// RDSDriver schedules the DB instances and Aurora clusters of a region
+// instances of a cluster are left out, the cluster is started and stopped as a whole
+// Aurora Serverless v1 clusters scale to zero on their own and can't be stopped, they are left out too
+type RDSDriver struct {
+	client RDSAPI
+	region string
+	// tag recording when a database was stopped (scheduleTagStopped), AWS restarts it after RDSMaxStopped
+	stoppedTag string
+	now        func() time.Time
+}
+
+func NewRDSDriver(client RDSAPI, region, stoppedTag string) *RDSDriver {
+	return &RDSDriver{client: client, region: region, stoppedTag: stoppedTag, now: time.Now}
+}
+
+func (d *RDSDriver) Types() []string {
+	return []string{ResourceTypeDBInstance, ResourceTypeDBCluster}
+}
+
+// following Marker, databases in transition are left out until the next run
+func (d *RDSDriver) List(ctx context.Context, tagKey string) ([]Resource, error) {
+	instances, err := d.describeInstances(ctx, &rds.DescribeDBInstancesInput{})
+	if err != nil {
+		return nil, err
+	}
+	clusters, err := d.describeClusters(ctx, &rds.DescribeDBClustersInput{})
+	if err != nil {
+		return nil, err
+	}
+
+	resources := []Resource{}
+	for _, r := range append(instances, clusters...) {
+		if _, ok := r.Tags[tagKey]; !ok {
+			continue
+		}
+		if r.State != StateRunning && r.State != StateStopped {
+			log.Printf("[%s/%s] status %s. Skipping", r.Region, r.ID, r.State)
+			continue
+		}
+		resources = append(resources, r)
+	}
+
+	return resources, nil
+}
+
+func (d *RDSDriver) Get(ctx context.Context, resourceType, id string) (Resource, error) {
+	var resources []Resource
+	var err error
+	switch resourceType {
+	case ResourceTypeDBInstance:
+		resources, err = d.describeInstances(ctx, &rds.DescribeDBInstancesInput{DBInstanceIdentifier: aws.String(id)})
+	case ResourceTypeDBCluster:
+		resources, err = d.describeClusters(ctx, &rds.DescribeDBClustersInput{DBClusterIdentifier: aws.String(id)})
+	}
+	// RDS fails rather than returning nothing
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) && (apiErr.ErrorCode() == "DBInstanceNotFound" || apiErr.ErrorCode() == "DBClusterNotFoundFault") {
+		return Resource{}, ErrNotFound
+	}
+	if err != nil {
+		return Resource{}, err
+	}
+	if len(resources) < 1 {
+		return Resource{}, ErrNotFound
+	}
+
+	return resources[0], nil
+}
+
+func (d *RDSDriver) describeInstances(ctx context.Context, input *rds.DescribeDBInstancesInput) ([]Resource, error) {
+	resources := []Resource{}
+	paginator := rds.NewDescribeDBInstancesPaginator(d.client, input)
+	for paginator.HasMorePages() {
+		resp, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, instance := range resp.DBInstances {
+			if instance.DBClusterIdentifier != nil {
+				continue
+			}
+			resources = append(resources, d.resource(ResourceTypeDBInstance, aws.ToString(instance.DBInstanceIdentifier),
+				aws.ToString(instance.DBInstanceArn), aws.ToString(instance.DBInstanceStatus), instance.TagList))
+		}
+	}
+
+	return resources, nil
+}
+
+func (d *RDSDriver) describeClusters(ctx context.Context, input *rds.DescribeDBClustersInput) ([]Resource, error) {
+	resources := []Resource{}
+	paginator := rds.NewDescribeDBClustersPaginator(d.client, input)
+	for paginator.HasMorePages() {
+		resp, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, cluster := range resp.DBClusters {
+			if aws.ToString(cluster.EngineMode) == "serverless" {
+				continue
+			}
+			resources = append(resources, d.resource(ResourceTypeDBCluster, aws.ToString(cluster.DBClusterIdentifier),
+				aws.ToString(cluster.DBClusterArn), aws.ToString(cluster.Status), cluster.TagList))
+		}
+	}
+
+	return resources, nil
+}
+
+func (d *RDSDriver) resource(resourceType, id, arn, status string, rdsTags []rdstypes.Tag) Resource {
+	state := State(status)
+	switch status {
+	case rdsStatusAvailable:
+		state = StateRunning
+	case rdsStatusStopped:
+		state = StateStopped
+	}
+
+	tags := map[string]string{}
+	for _, tag := range rdsTags {
+		tags[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+	}
+
+	return Resource{
+		Type:    resourceType,
+		ID:      id,
+		Name:    id,
+		ARN:     arn,
+		Account: arnAccount(arn),
+		Region:  d.region,
+		State:   state,
+		Tags:    tags,
+	}
+}
+
+// start the databases, the stopped tag doesn't apply anymore
+func (d *RDSDriver) Start(ctx context.Context, resources []Resource) []error {
+	errs := make([]error, len(resources))
+	for i, r := range resources {
+		var err error
+		if r.Type == ResourceTypeDBCluster {
+			_, err = d.client.StartDBCluster(ctx, &rds.StartDBClusterInput{DBClusterIdentifier: aws.String(r.ID)})
+		} else {
+			_, err = d.client.StartDBInstance(ctx, &rds.StartDBInstanceInput{DBInstanceIdentifier: aws.String(r.ID)})
+		}
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		log.Printf("[%s/%s] state changed to %s", r.Region, r.ID, StateRunning)
+
+		if _, ok := r.Tags[d.stoppedTag]; ok {
+			if err := d.DeleteTags(ctx, r, d.stoppedTag); err != nil {
+				log.Printf("[%s/%s] unable to remove %s: %s", r.Region, r.ID, d.stoppedTag, err)
+			}
+		}
+	}
+
+	return errs
+}
+
+// stop the databases, recording when in the stopped tag
+func (d *RDSDriver) Stop(ctx context.Context, resources []Resource) []error {
+	errs := make([]error, len(resources))
+	for i, r := range resources {
+		var err error
+		if r.Type == ResourceTypeDBCluster {
+			_, err = d.client.StopDBCluster(ctx, &rds.StopDBClusterInput{DBClusterIdentifier: aws.String(r.ID)})
+		} else {
+			_, err = d.client.StopDBInstance(ctx, &rds.StopDBInstanceInput{DBInstanceIdentifier: aws.String(r.ID)})
+		}
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		log.Printf("[%s/%s] state changed to %s", r.Region, r.ID, StateStopped)
+
+		err = d.CreateTags(ctx, r, map[string]string{d.stoppedTag: d.now().UTC().Format(time.RFC3339)})
+		if err != nil {
+			log.Printf("[%s/%s] unable to tag %s, won't be stopped again once AWS restarts it: %s", r.Region, r.ID, d.stoppedTag, err)
+		}
+	}
+
+	return errs
+}
+
+func (d *RDSDriver) CreateTags(ctx context.Context, resource Resource, tags map[string]string) error {
+	rdsTags := []rdstypes.Tag{}
+	for _, k := range sortedKeys(tags) {
+		rdsTags = append(rdsTags, rdstypes.Tag{Key: aws.String(k), Value: aws.String(tags[k])})
+	}
+
+	_, err := d.client.AddTagsToResource(ctx, &rds.AddTagsToResourceInput{
+		ResourceName: aws.String(resource.ARN),
+		Tags:         rdsTags,
+	})
+	return err
+}
+
+func (d *RDSDriver) DeleteTags(ctx context.Context, resource Resource, keys ...string) error {
+	_, err := d.client.RemoveTagsFromResource(ctx, &rds.RemoveTagsFromResourceInput{
+		ResourceName: aws.String(resource.ARN),
+		TagKeys:      keys,
+	})
+	return err
+}
@@ -0,0 +1,177 @@
+package lib
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/rds"
+	rdstypes "github.com/aws/aws-sdk-go-v2/service/rds/types"
+	"github.com/aws/smithy-go"
+	"github.com/stretchr/testify/assert"
+)
+
+var _ RDSAPI = (*mockRDSClient)(nil)
+var _ Driver = (*RDSDriver)(nil)
+
+type mockRDSClient struct {
+	err       error
+	instances []rdstypes.DBInstance
+	clusters  []rdstypes.DBCluster
+
+	started     []string
+	stopped     []string
+	tags        map[string][]rdstypes.Tag
+	removedTags map[string][]string
+}
+
+func (m *mockRDSClient) DescribeDBInstances(ctx context.Context, params *rds.DescribeDBInstancesInput, optFns ...func(*rds.Options)) (*rds.DescribeDBInstancesOutput, error) {
+	return &rds.DescribeDBInstancesOutput{DBInstances: m.instances}, m.err
+}
+
+func (m *mockRDSClient) DescribeDBClusters(ctx context.Context, params *rds.DescribeDBClustersInput, optFns ...func(*rds.Options)) (*rds.DescribeDBClustersOutput, error) {
+	return &rds.DescribeDBClustersOutput{DBClusters: m.clusters}, m.err
+}
+
+func (m *mockRDSClient) StartDBInstance(ctx context.Context, params *rds.StartDBInstanceInput, optFns ...func(*rds.Options)) (*rds.StartDBInstanceOutput, error) {
+	m.started = append(m.started, *params.DBInstanceIdentifier)
+	return &rds.StartDBInstanceOutput{}, m.err
+}
+
+func (m *mockRDSClient) StopDBInstance(ctx context.Context, params *rds.StopDBInstanceInput, optFns ...func(*rds.Options)) (*rds.StopDBInstanceOutput, error) {
+	m.stopped = append(m.stopped, *params.DBInstanceIdentifier)
+	return &rds.StopDBInstanceOutput{}, m.err
+}
+
+func (m *mockRDSClient) StartDBCluster(ctx context.Context, params *rds.StartDBClusterInput, optFns ...func(*rds.Options)) (*rds.StartDBClusterOutput, error) {
+	m.started = append(m.started, *params.DBClusterIdentifier)
+	return &rds.StartDBClusterOutput{}, m.err
+}
+
+func (m *mockRDSClient) StopDBCluster(ctx context.Context, params *rds.StopDBClusterInput, optFns ...func(*rds.Options)) (*rds.StopDBClusterOutput, error) {
+	m.stopped = append(m.stopped, *params.DBClusterIdentifier)
+	return &rds.StopDBClusterOutput{}, m.err
+}
+
+func (m *mockRDSClient) AddTagsToResource(ctx context.Context, params *rds.AddTagsToResourceInput, optFns ...func(*rds.Options)) (*rds.AddTagsToResourceOutput, error) {
+	if m.tags == nil {
+		m.tags = map[string][]rdstypes.Tag{}
+	}
+	m.tags[*params.ResourceName] = append(m.tags[*params.ResourceName], params.Tags...)
+	return &rds.AddTagsToResourceOutput{}, m.err
+}
+
+func (m *mockRDSClient) RemoveTagsFromResource(ctx context.Context, params *rds.RemoveTagsFromResourceInput, optFns ...func(*rds.Options)) (*rds.RemoveTagsFromResourceOutput, error) {
+	if m.removedTags == nil {
+		m.removedTags = map[string][]string{}
+	}
+	m.removedTags[*params.ResourceName] = append(m.removedTags[*params.ResourceName], params.TagKeys...)
+	return &rds.RemoveTagsFromResourceOutput{}, m.err
+}
+
+func TestRDSDriverList(t *testing.T) {
+	d := NewRDSDriver(&mockRDSClient{
+		instances: []rdstypes.DBInstance{
+			{
+				DBInstanceIdentifier: aws.String("postgres"),
+				DBInstanceArn:        aws.String("arn:aws:rds:eu-west-1:123456789012:db:postgres"),
+				DBInstanceStatus:     aws.String("stopped"),
+				TagList: []rdstypes.Tag{
+					{Key: aws.String("Schedule"), Value: aws.String("07:00-19:00")},
+					{Key: aws.String("ScheduleStoppedAt"), Value: aws.String("2021-01-04T19:00:00Z")},
+				},
+			},
+			{
+				DBInstanceIdentifier: aws.String("mysql"),
+				DBInstanceStatus:     aws.String("backing-up"),
+				TagList:              []rdstypes.Tag{{Key: aws.String("Schedule"), Value: aws.String("07:00-19:00")}},
+			},
+			{
+				DBInstanceIdentifier: aws.String("unscheduled"),
+				DBInstanceStatus:     aws.String("available"),
+			},
+			// member of the aurora cluster, scheduled with it
+			{
+				DBInstanceIdentifier: aws.String("aurora-1"),
+				DBClusterIdentifier:  aws.String("aurora"),
+				DBInstanceStatus:     aws.String("available"),
+				TagList:              []rdstypes.Tag{{Key: aws.String("Schedule"), Value: aws.String("07:00-19:00")}},
+			},
+		},
+		clusters: []rdstypes.DBCluster{
+			{
+				DBClusterIdentifier: aws.String("aurora"),
+				DBClusterArn:        aws.String("arn:aws:rds:eu-west-1:123456789012:cluster:aurora"),
+				Status:              aws.String("available"),
+				EngineMode:          aws.String("provisioned"),
+				TagList:             []rdstypes.Tag{{Key: aws.String("Schedule"), Value: aws.String("07:00-19:00")}},
+			},
+			{
+				DBClusterIdentifier: aws.String("serverless"),
+				Status:              aws.String("available"),
+				EngineMode:          aws.String("serverless"),
+				TagList:             []rdstypes.Tag{{Key: aws.String("Schedule"), Value: aws.String("07:00-19:00")}},
+			},
+		},
+	}, "eu-west-1", "ScheduleStoppedAt")
+
+	got, err := d.List(context.Background(), "Schedule")
+	assert.NoError(t, err)
+	assert.Len(t, got, 2)
+
+	assert.Equal(t, Resource{
+		Type:    ResourceTypeDBInstance,
+		ID:      "postgres",
+		Name:    "postgres",
+		ARN:     "arn:aws:rds:eu-west-1:123456789012:db:postgres",
+		Account: "123456789012",
+		Region:  "eu-west-1",
+		State:   StateStopped,
+		Tags:    map[string]string{"Schedule": "07:00-19:00", "ScheduleStoppedAt": "2021-01-04T19:00:00Z"},
+	}, got[0])
+	assert.Equal(t, ResourceTypeDBCluster, got[1].Type)
+	assert.Equal(t, "aurora", got[1].ID)
+	assert.Equal(t, StateRunning, got[1].State)
+
+	_, err = NewRDSDriver(&mockRDSClient{err: fmt.Errorf("AccessDenied")}, "eu-west-1", "ScheduleStoppedAt").List(context.Background(), "Schedule")
+	assert.Error(t, err)
+
+	// RDS fails on a missing database
+	d = NewRDSDriver(&mockRDSClient{err: &smithy.GenericAPIError{Code: "DBInstanceNotFound"}}, "eu-west-1", "ScheduleStoppedAt")
+	_, err = d.Get(context.Background(), ResourceTypeDBInstance, "missing")
+	assert.Equal(t, ErrNotFound, err)
+}
+
+func TestRDSDriverStartStop(t *testing.T) {
+	client := &mockRDSClient{}
+	d := NewRDSDriver(client, "eu-west-1", "ScheduleStoppedAt")
+	d.now = func() time.Time { return time.Date(2021, 01, 11, 19, 00, 00, 00, time.UTC) }
+
+	postgres := Resource{Type: ResourceTypeDBInstance, ID: "postgres", ARN: "arn:aws:rds:eu-west-1:123456789012:db:postgres"}
+	aurora := Resource{
+		Type: ResourceTypeDBCluster,
+		ID:   "aurora",
+		ARN:  "arn:aws:rds:eu-west-1:123456789012:cluster:aurora",
+		Tags: map[string]string{"ScheduleStoppedAt": "2021-01-11T07:00:00Z"},
+	}
+
+	assert.Equal(t, []error{nil}, d.Stop(context.Background(), []Resource{postgres}))
+	assert.Equal(t, []error{nil}, d.Start(context.Background(), []Resource{aurora}))
+
+	assert.Equal(t, []string{"postgres"}, client.stopped)
+	assert.Equal(t, []string{"aurora"}, client.started)
+	assert.Equal(t, map[string][]rdstypes.Tag{
+		"arn:aws:rds:eu-west-1:123456789012:db:postgres": {{Key: aws.String("ScheduleStoppedAt"), Value: aws.String("2021-01-11T19:00:00Z")}},
+	}, client.tags)
+	assert.Equal(t, map[string][]string{
+		"arn:aws:rds:eu-west-1:123456789012:cluster:aurora": {"ScheduleStoppedAt"},
+	}, client.removedTags)
+
+	// a failed stop isn't recorded
+	client = &mockRDSClient{err: fmt.Errorf("InvalidDBInstanceState")}
+	errs := NewRDSDriver(client, "eu-west-1", "ScheduleStoppedAt").Stop(context.Background(), []Resource{postgres})
+	assert.Error(t, errs[0])
+	assert.Empty(t, client.tags)
+}
@@ -0,0 +1,86 @@
+package lib
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+)
+
+// REGIONS value to schedule every region enabled in the account
+const AllRegions = "all"
+
+// regions the functions schedule instances in, comma separated or AllRegions
+// the Lambda region if empty
+type RegionConfig struct {
+	Regions string `env:"REGIONS"`
+}
+
+// EC2 call to discover the enabled regions, *ec2.Client implements it
+type EC2RegionsAPI interface {
+	DescribeRegions(ctx context.Context, params *ec2.DescribeRegionsInput, optFns ...func(*ec2.Options)) (*ec2.DescribeRegionsOutput, error)
+}
+
+// regions of the REGIONS setting, defaultRegion (the Lambda one) if empty
+// AllRegions is resolved with DescribeRegions, which only lists the regions enabled in the account
+func ParseRegions(ctx context.Context, client EC2RegionsAPI, setting, defaultRegion string) ([]string, error) {
+	setting = strings.TrimSpace(setting)
+	if setting == "" {
+		return []string{defaultRegion}, nil
+	}
+
+	regions := []string{}
+	if strings.EqualFold(setting, AllRegions) {
+		resp, err := client.DescribeRegions(ctx, &ec2.DescribeRegionsInput{})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, region := range resp.Regions {
+			regions = append(regions, aws.ToString(region.RegionName))
+		}
+		sort.Strings(regions)
+	} else {
+		for _, region := range strings.Split(setting, ",") {
+			if region = strings.TrimSpace(region); region != "" {
+				regions = append(regions, region)
+			}
+		}
+	}
+
+	if len(regions) < 1 {
+		return nil, fmt.Errorf("no region found in %q", setting)
+	}
+
+	return regions, nil
+}
+
+// run fn for every region concurrently
+// a region failing doesn't affect the others, return the errors by region
+func ForEachRegion(ctx context.Context, regions []string, fn func(ctx context.Context, region string) error) map[string]error {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	errs := map[string]error{}
+
+	for _, region := range regions {
+		wg.Add(1)
+		go func(region string) {
+			defer wg.Done()
+
+			if err := fn(ctx, region); err != nil {
+				log.Printf("[%s] %s", region, err)
+				mu.Lock()
+				errs[region] = err
+				mu.Unlock()
+			}
+		}(region)
+	}
+	wg.Wait()
+
+	return errs
+}
@@ -0,0 +1,93 @@
+package lib
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/stretchr/testify/assert"
+)
+
+var _ EC2RegionsAPI = (*mockRegionsClient)(nil)
+
+type mockRegionsClient struct {
+	err     error
+	regions []string
+}
+
+func (m *mockRegionsClient) DescribeRegions(ctx context.Context, params *ec2.DescribeRegionsInput, optFns ...func(*ec2.Options)) (*ec2.DescribeRegionsOutput, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+
+	resp := &ec2.DescribeRegionsOutput{}
+	for _, region := range m.regions {
+		resp.Regions = append(resp.Regions, types.Region{RegionName: aws.String(region)})
+	}
+	return resp, nil
+}
+
+func TestParseRegions(t *testing.T) {
+	client := &mockRegionsClient{regions: []string{"us-east-1", "eu-west-1", "eu-north-1"}}
+
+	tests := []struct {
+		name    string
+		setting string
+		want    []string
+	}{
+		{
+			name: "Lambda region",
+			want: []string{"eu-west-1"},
+		},
+		{
+			name:    "list",
+			setting: "eu-west-1, eu-north-1,us-east-1",
+			want:    []string{"eu-west-1", "eu-north-1", "us-east-1"},
+		},
+		{
+			name:    "all",
+			setting: "all",
+			want:    []string{"eu-north-1", "eu-west-1", "us-east-1"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := ParseRegions(context.Background(), client, test.setting, "eu-west-1")
+			assert.NoError(t, err)
+			assert.Equal(t, test.want, got)
+		})
+	}
+
+	_, err := ParseRegions(context.Background(), &mockRegionsClient{err: fmt.Errorf("UnauthorizedOperation")}, "all", "eu-west-1")
+	assert.Error(t, err)
+
+	// nothing to schedule is a mistake, not a success
+	_, err = ParseRegions(context.Background(), client, " , ", "eu-west-1")
+	assert.Error(t, err)
+	_, err = ParseRegions(context.Background(), &mockRegionsClient{}, "all", "eu-west-1")
+	assert.Error(t, err)
+}
+
+func TestForEachRegion(t *testing.T) {
+	var mu sync.Mutex
+	done := []string{}
+
+	errs := ForEachRegion(context.Background(), []string{"eu-west-1", "eu-north-1", "us-east-1"}, func(ctx context.Context, region string) error {
+		if region == "eu-north-1" {
+			return fmt.Errorf("AuthFailure")
+		}
+
+		mu.Lock()
+		done = append(done, region)
+		mu.Unlock()
+		return nil
+	})
+
+	assert.ElementsMatch(t, []string{"eu-west-1", "us-east-1"}, done)
+	assert.Equal(t, map[string]error{"eu-north-1": fmt.Errorf("AuthFailure")}, errs)
+}
@@ -0,0 +1,231 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// time range the instance should be running in
+// StartTime after StopTime means the window spans midnight (22:00-03:00)
+// Weekdays nil means the window follows ScheduleDay
+type TimeWindow struct {
+	StartTime time.Time
+	StopTime  time.Time
+	Weekdays  []time.Weekday
+}
+
+// day names accepted in the Schedule tag (Mon-Thu 07:00-19:00)
+var WeekdayNames = map[string]time.Weekday{
+	"sun": time.Sunday, "sunday": time.Sunday,
+	"mon": time.Monday, "monday": time.Monday,
+	"tue": time.Tuesday, "tuesday": time.Tuesday,
+	"wed": time.Wednesday, "wednesday": time.Wednesday,
+	"thu": time.Thursday, "thursday": time.Thursday,
+	"fri": time.Friday, "friday": time.Friday,
+	"sat": time.Saturday, "saturday": time.Saturday,
+}
+
+// check if timeNow (null value for YYYY, mm, dd) falls inside the window
+func (w TimeWindow) Contains(timeNow time.Time) bool {
+	// startTime-stopTime same day (07:00-19:30), running from startTime on
+	if w.StartTime.Before(w.StopTime) {
+		return !timeNow.Before(w.StartTime) && timeNow.Before(w.StopTime)
+	}
+
+	// startTime-stopTime between days (22:00-03:00 = 22:00-midnight, midnight-03:00)
+	return !timeNow.Before(w.StartTime) || timeNow.Before(w.StopTime)
+}
+
+func (w TimeWindow) String() string {
+	if w.Weekdays == nil {
+		return fmt.Sprintf("%s-%s", w.StartTime.Format("15:04"), w.StopTime.Format("15:04"))
+	}
+
+	return fmt.Sprintf("%v %s-%s", w.Weekdays, w.StartTime.Format("15:04"), w.StopTime.Format("15:04"))
+}
+
+// parse the Schedule tag value into time windows
+// 07:00-19:00                           single window, days from ScheduleDay
+// 06:00-09:00,18:00-22:00               multiple windows
+// Mon-Thu 07:00-19:00, Fri 07:00-15:00  windows with their own days
+// a window without days gets the days of the window before it (Mon 06:00-09:00,18:00-22:00)
+func ParseWindows(value string) ([]TimeWindow, error) {
+	windows := []TimeWindow{}
+	var weekdays []time.Weekday
+	for _, window := range strings.Split(value, ",") {
+		fields := strings.Fields(window)
+		if len(fields) == 2 {
+			var err error
+			weekdays, err = ParseWeekdays(fields[0])
+			if err != nil {
+				return nil, err
+			}
+			fields = fields[1:]
+		}
+		if len(fields) != 1 {
+			return nil, fmt.Errorf("invalid time window %s", window)
+		}
+
+		startStopTime := strings.Split(fields[0], "-")
+		if len(startStopTime) != 2 {
+			return nil, fmt.Errorf("invalid time window %s", window)
+		}
+
+		startTime, err := time.Parse("15:04", startStopTime[0])
+		if err != nil {
+			return nil, fmt.Errorf("start time in wrong format %s: %s", startStopTime[0], err)
+		}
+		stopTime, err := time.Parse("15:04", startStopTime[1])
+		if err != nil {
+			return nil, fmt.Errorf("stop time in wrong format %s: %s", startStopTime[1], err)
+		}
+
+		windows = append(windows, TimeWindow{
+			StartTime: startTime,
+			StopTime:  stopTime,
+			Weekdays:  weekdays,
+		})
+	}
+
+	return windows, nil
+}
+
+// parse a day (Fri) or a range of days (Mon-Thu, Fri-Mon)
+func ParseWeekdays(value string) ([]time.Weekday, error) {
+	firstLast := strings.Split(value, "-")
+	if len(firstLast) > 2 {
+		return nil, fmt.Errorf("invalid days %s", value)
+	}
+
+	first, ok := WeekdayNames[strings.ToLower(firstLast[0])]
+	if !ok {
+		return nil, fmt.Errorf("invalid day %s", firstLast[0])
+	}
+	last := first
+	if len(firstLast) == 2 {
+		last, ok = WeekdayNames[strings.ToLower(firstLast[1])]
+		if !ok {
+			return nil, fmt.Errorf("invalid day %s", firstLast[1])
+		}
+	}
+
+	weekdays := []time.Weekday{first}
+	for d := first; d != last; {
+		d = (d + 1) % 7
+		weekdays = append(weekdays, d)
+	}
+
+	return weekdays, nil
+}
+
+// parse the ScheduleDay tag value, week days as numbers (1,2,3,4,5), Sunday is 0 or 7 (ISO)
+func ParseScheduleDay(value string) ([]time.Weekday, error) {
+	weekdays := []time.Weekday{}
+	if err := json.Unmarshal([]byte(fmt.Sprintf("[%s]", value)), &weekdays); err != nil {
+		return nil, err
+	}
+
+	for i, d := range weekdays {
+		if d < time.Sunday || d > 7 {
+			return nil, fmt.Errorf("invalid week day %d", d)
+		}
+		weekdays[i] = d % 7
+	}
+
+	return weekdays, nil
+}
+
+// check the Schedule tag syntax, cron expressions or time windows
+// a disabled/suspended schedule (#07:00-19:00) isn't one, uncomment it first
+func ValidateSchedule(value string) error {
+	value = strings.TrimSpace(value)
+	if ScheduleDisabled(value) {
+		return fmt.Errorf("schedule %s is commented out", value)
+	}
+	if IsCronSchedule(value) {
+		_, _, err := ParseCronSchedule(value)
+		return err
+	}
+
+	_, err := ParseWindows(value)
+	return err
+}
+
+// check if the Schedule tag is commented out (suspended or disabled)
+func ScheduleDisabled(value string) bool {
+	return strings.Contains(value, "#")
+}
+
+// comment out the Schedule tag, keeping the schedule to restore it later
+func DisableSchedule(value string) string {
+	if ScheduleDisabled(value) {
+		return value
+	}
+
+	return fmt.Sprintf("#%s", value)
+}
+
+// uncomment the Schedule tag
+func EnableSchedule(value string) string {
+	return strings.Replace(value, "#", "", -1)
+}
+
+// suspend modes, the state enforced while suspended (ScheduleSuspendMode)
+const (
+	// leave the instance as it is, no ScheduleSuspendMode tag
+	SuspendModeFreeze = "freeze"
+	// start the instance if stopped, keep it running
+	SuspendModeRunning = "running"
+	// stop the instance if running, keep it stopped
+	SuspendModeStopped = "stopped"
+)
+
+// accepted suspend modes and their canonical form
+var SuspendModes = map[string]string{
+	"":             SuspendModeFreeze,
+	"freeze":       SuspendModeFreeze,
+	"running":      SuspendModeRunning,
+	"run":          SuspendModeRunning,
+	"keep-running": SuspendModeRunning,
+	"stopped":      SuspendModeStopped,
+	"stop":         SuspendModeStopped,
+	"keep-stopped": SuspendModeStopped,
+}
+
+// parse a suspend mode to its canonical form
+func ParseSuspendMode(value string) (string, error) {
+	mode, ok := SuspendModes[strings.ToLower(strings.TrimSpace(value))]
+	if !ok {
+		return "", fmt.Errorf("invalid suspend mode %s, expected freeze, running or stopped", value)
+	}
+
+	return mode, nil
+}
+
+// split a schedule into rules, one per set of days
+// Mon-Thu 07:00-19:00, Fri 07:00-12:00,13:00-15:00 -> [Mon-Thu 07:00-19:00, Fri 07:00-12:00,13:00-15:00]
+// start=0 7 * * 1-5;stop=30 18 * * 1-5 -> [start=0 7 * * 1-5, stop=30 18 * * 1-5]
+func ScheduleRules(schedule string) []string {
+	rules := []string{}
+	if strings.Contains(schedule, "=") {
+		for _, rule := range strings.Split(schedule, ";") {
+			rules = append(rules, strings.TrimSpace(rule))
+		}
+		return rules
+	}
+
+	for _, window := range strings.Split(schedule, ",") {
+		window = strings.TrimSpace(window)
+
+		// a window starting with a day opens a new rule, otherwise it belongs to the previous one
+		if len(rules) == 0 || len(strings.Fields(window)) > 1 {
+			rules = append(rules, window)
+			continue
+		}
+		rules[len(rules)-1] = fmt.Sprintf("%s,%s", rules[len(rules)-1], window)
+	}
+
+	return rules
+}
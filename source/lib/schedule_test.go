@@ -0,0 +1,337 @@
+package lib
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseWindows(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  []TimeWindow
+		err   bool
+	}{
+		{
+			name:  "single window",
+			value: "07:00-19:00",
+			want: []TimeWindow{
+				{
+					StartTime: time.Date(0000, 01, 01, 7, 00, 00, 00, time.UTC),
+					StopTime:  time.Date(0000, 01, 01, 19, 00, 00, 00, time.UTC),
+				},
+			},
+		},
+		{
+			name:  "multiple windows",
+			value: "06:00-09:00, 18:00-22:00,22:30-03:00",
+			want: []TimeWindow{
+				{
+					StartTime: time.Date(0000, 01, 01, 6, 00, 00, 00, time.UTC),
+					StopTime:  time.Date(0000, 01, 01, 9, 00, 00, 00, time.UTC),
+				},
+				{
+					StartTime: time.Date(0000, 01, 01, 18, 00, 00, 00, time.UTC),
+					StopTime:  time.Date(0000, 01, 01, 22, 00, 00, 00, time.UTC),
+				},
+				{
+					StartTime: time.Date(0000, 01, 01, 22, 30, 00, 00, time.UTC),
+					StopTime:  time.Date(0000, 01, 01, 3, 00, 00, 00, time.UTC),
+				},
+			},
+		},
+		{
+			name:  "windows with days",
+			value: "Mon-Thu 07:00-19:00, Fri 07:00-15:00,16:00-18:00, saturday 10:00-14:00",
+			want: []TimeWindow{
+				{
+					StartTime: time.Date(0000, 01, 01, 7, 00, 00, 00, time.UTC),
+					StopTime:  time.Date(0000, 01, 01, 19, 00, 00, 00, time.UTC),
+					Weekdays:  []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday},
+				},
+				{
+					StartTime: time.Date(0000, 01, 01, 7, 00, 00, 00, time.UTC),
+					StopTime:  time.Date(0000, 01, 01, 15, 00, 00, 00, time.UTC),
+					Weekdays:  []time.Weekday{time.Friday},
+				},
+				{
+					StartTime: time.Date(0000, 01, 01, 16, 00, 00, 00, time.UTC),
+					StopTime:  time.Date(0000, 01, 01, 18, 00, 00, 00, time.UTC),
+					Weekdays:  []time.Weekday{time.Friday},
+				},
+				{
+					StartTime: time.Date(0000, 01, 01, 10, 00, 00, 00, time.UTC),
+					StopTime:  time.Date(0000, 01, 01, 14, 00, 00, 00, time.UTC),
+					Weekdays:  []time.Weekday{time.Saturday},
+				},
+			},
+		},
+		{
+			name:  "days range over the weekend",
+			value: "Fri-Mon 10:00-14:00",
+			want: []TimeWindow{
+				{
+					StartTime: time.Date(0000, 01, 01, 10, 00, 00, 00, time.UTC),
+					StopTime:  time.Date(0000, 01, 01, 14, 00, 00, 00, time.UTC),
+					Weekdays:  []time.Weekday{time.Friday, time.Saturday, time.Sunday, time.Monday},
+				},
+			},
+		},
+		{
+			name:  "missing stop time",
+			value: "06:00-09:00,18:00",
+			err:   true,
+		},
+		{
+			name:  "unknown day",
+			value: "Mon-Fry 07:00-19:00",
+			err:   true,
+		},
+		{
+			name:  "wrong format",
+			value: "06:00-25:00",
+			err:   true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := ParseWindows(test.value)
+			if test.err {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, test.want, got)
+		})
+	}
+}
+
+func TestTimeWindowContains(t *testing.T) {
+	tests := []struct {
+		name   string
+		window string
+		now    time.Time
+		want   bool
+	}{
+		{
+			name:   "inside",
+			window: "07:00-19:00",
+			now:    time.Date(0000, 01, 01, 12, 00, 00, 00, time.UTC),
+			want:   true,
+		},
+		{
+			name:   "outside",
+			window: "07:00-19:00",
+			now:    time.Date(0000, 01, 01, 19, 30, 00, 00, time.UTC),
+			want:   false,
+		},
+		{
+			name:   "across midnight - before midnight",
+			window: "22:00-03:00",
+			now:    time.Date(0000, 01, 01, 23, 00, 00, 00, time.UTC),
+			want:   true,
+		},
+		{
+			name:   "across midnight - after midnight",
+			window: "22:00-03:00",
+			now:    time.Date(0000, 01, 01, 02, 00, 00, 00, time.UTC),
+			want:   true,
+		},
+		{
+			name:   "across midnight - outside",
+			window: "22:00-03:00",
+			now:    time.Date(0000, 01, 01, 12, 00, 00, 00, time.UTC),
+			want:   false,
+		},
+		{
+			name:   "exact start",
+			window: "07:00-19:00",
+			now:    time.Date(0000, 01, 01, 07, 00, 00, 00, time.UTC),
+			want:   true,
+		},
+		{
+			name:   "exact stop",
+			window: "07:00-19:00",
+			now:    time.Date(0000, 01, 01, 19, 00, 00, 00, time.UTC),
+			want:   false,
+		},
+		{
+			name:   "across midnight - exact start",
+			window: "22:00-03:00",
+			now:    time.Date(0000, 01, 01, 22, 00, 00, 00, time.UTC),
+			want:   true,
+		},
+		{
+			name:   "across midnight - 23:59",
+			window: "22:00-03:00",
+			now:    time.Date(0000, 01, 01, 23, 59, 00, 00, time.UTC),
+			want:   true,
+		},
+		{
+			name:   "across midnight - midnight",
+			window: "22:00-03:00",
+			now:    time.Date(0000, 01, 01, 00, 00, 00, 00, time.UTC),
+			want:   true,
+		},
+		{
+			name:   "across midnight - exact stop",
+			window: "22:00-03:00",
+			now:    time.Date(0000, 01, 01, 03, 00, 00, 00, time.UTC),
+			want:   false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			windows, err := ParseWindows(test.window)
+			assert.NoError(t, err)
+
+			assert.Equal(t, test.want, windows[0].Contains(test.now))
+		})
+	}
+}
+
+func TestParseScheduleDay(t *testing.T) {
+	got, err := ParseScheduleDay("1,3,5")
+	assert.NoError(t, err)
+	assert.Equal(t, []time.Weekday{time.Monday, time.Wednesday, time.Friday}, got)
+
+	// ISO Sunday
+	got, err = ParseScheduleDay("1,2,3,4,5,6,7")
+	assert.NoError(t, err)
+	assert.Equal(t, []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday, time.Saturday, time.Sunday}, got)
+
+	_, err = ParseScheduleDay("1,8")
+	assert.Error(t, err)
+
+	_, err = ParseScheduleDay("Mon")
+	assert.Error(t, err)
+}
+
+func TestValidateSchedule(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		err   bool
+	}{
+		{
+			name:  "single window",
+			value: "07:00-19:00",
+		},
+		{
+			name:  "per-day windows",
+			value: "Mon-Thu 07:00-19:00, Fri 07:00-12:00,13:00-15:00",
+		},
+		{
+			name:  "disabled",
+			value: "#07:00-19:00",
+			err:   true,
+		},
+		{
+			name:  "cron",
+			value: "start=0 7 * * 1-5;stop=30 18 * * 1-5",
+		},
+		{
+			name:  "invalid time",
+			value: "07:00-25:00",
+			err:   true,
+		},
+		{
+			name:  "invalid day",
+			value: "Mon-Fun 07:00-19:00",
+			err:   true,
+		},
+		{
+			name:  "invalid cron",
+			value: "start=0 7 * 1-5",
+			err:   true,
+		},
+		{
+			name:  "empty",
+			value: "",
+			err:   true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := ValidateSchedule(test.value)
+			if test.err {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestDisableEnableSchedule(t *testing.T) {
+	assert.Equal(t, "#07:00-19:00", DisableSchedule("07:00-19:00"))
+	assert.Equal(t, "#07:00-19:00", DisableSchedule("#07:00-19:00"))
+	assert.True(t, ScheduleDisabled("#07:00-19:00"))
+	assert.False(t, ScheduleDisabled("07:00-19:00"))
+	assert.Equal(t, "07:00-19:00", EnableSchedule("#07:00-19:00"))
+	assert.Equal(t, "07:00-19:00", EnableSchedule("07:00-19:00"))
+}
+
+func TestScheduleRules(t *testing.T) {
+	tests := []struct {
+		name     string
+		schedule string
+		want     []string
+	}{
+		{
+			name:     "single window",
+			schedule: "07:00-19:00",
+			want:     []string{"07:00-19:00"},
+		},
+		{
+			name:     "per-day windows",
+			schedule: "Mon-Thu 07:00-19:00, Fri 07:00-12:00,13:00-15:00",
+			want:     []string{"Mon-Thu 07:00-19:00", "Fri 07:00-12:00,13:00-15:00"},
+		},
+		{
+			name:     "cron",
+			schedule: "start=0 7 * * 1-5; stop=30 18 * * 1-5",
+			want:     []string{"start=0 7 * * 1-5", "stop=30 18 * * 1-5"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.want, ScheduleRules(test.schedule))
+		})
+	}
+}
+
+func TestParseSuspendMode(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+		err   bool
+	}{
+		{value: "", want: SuspendModeFreeze},
+		{value: "freeze", want: SuspendModeFreeze},
+		{value: "Keep-Running", want: SuspendModeRunning},
+		{value: "stop", want: SuspendModeStopped},
+		{value: "hibernate", err: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.value, func(t *testing.T) {
+			got, err := ParseSuspendMode(test.value)
+			if test.err {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, test.want, got)
+		})
+	}
+}
@@ -1,34 +1,35 @@
 package main
 
-// Disable scheduler
+// Disable scheduler, the schedule is kept commented out (#07:00-19:00) and restored by ec2scheduler-enable
 // event:
-// { "instanceId": "i-00e92a5a9cb7eeb4d" }
+// { "instanceId": "i-00e92a5a9cb7eeb4d", "user": "jane", "reason": "load testing" }
+// { "type": "dbInstance", "instanceId": "orders" }
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
-	"strings"
 
 	"github.com/aws/aws-lambda-go/lambda"
-	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/service/ec2"
-	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
 	"github.com/caarlos0/env/v6"
+	"github.com/dwtechnologies/ec2scheduler/source/lib"
 )
 
 type inputEvent struct {
+	// instance (default), autoScalingGroup, dbInstance, dbCluster or ecsService (cluster/service)
+	Type       string `json:"type"`
 	InstanceID string `json:"instanceId"`
+	// optional, recorded in scheduleTagDisabledBy and scheduleTagDisabledReason
+	User   string `json:"user"`
+	Reason string `json:"reason"`
 }
 
 type lambdaConfig struct {
-	ScheduleTag string `env:"SCHEDULE_TAG" envDefault:"Schedule"`
-}
-
-type ec2ClientAPI interface {
-	DescribeInstances(ctx context.Context, params *ec2.DescribeInstancesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeInstancesOutput, error)
-	CreateTags(ctx context.Context, params *ec2.CreateTagsInput, optFns ...func(*ec2.Options)) (*ec2.CreateTagsOutput, error)
+	lib.TagConfig
+	lib.EventConfig
 }
 
 func main() {
@@ -48,61 +49,72 @@ func handler(ctx context.Context, event inputEvent) (string, error) {
 		return "", err
 	}
 
-	client := ec2.NewFromConfig(cfg)
+	drivers := lib.NewDrivers(cfg, cfg.Region, conf.TagConfig)
+	publisher := lib.NewEventPublisher(eventbridge.NewFromConfig(cfg), conf.EventBus)
 
-	resp, err := describeInstances(ctx, client, event.InstanceID)
-	if err != nil {
-		return "", err
+	return disableScheduler(ctx, drivers, publisher, conf, event)
+}
+
+// comment out scheduleTag of the event resource, keeping the schedule
+func disableScheduler(ctx context.Context, drivers []lib.Driver, publisher *lib.EventPublisher, conf *lambdaConfig, event inputEvent) (string, error) {
+	if event.Type == "" {
+		event.Type = lib.ResourceTypeInstance
+	}
+	driver := lib.DriverOf(drivers, event.Type)
+	if driver == nil {
+		log.Printf("[%s] unknown type %s", event.InstanceID, event.Type)
+		return fmt.Sprintf("unknown type: %s", event.Type), nil
 	}
-	if len(resp.Reservations) < 1 {
-		log.Printf("[%s] no instance found", event.InstanceID)
+
+	resource, err := driver.Get(ctx, event.Type, event.InstanceID)
+	if errors.Is(err, lib.ErrNotFound) {
+		log.Printf("[%s] no %s found", event.InstanceID, event.Type)
 		return "", nil
 	}
+	if err != nil {
+		return "", err
+	}
 
-	for _, tag := range resp.Reservations[0].Instances[0].Tags {
-		if *tag.Key == conf.ScheduleTag {
-			if strings.Contains(*tag.Value, "#") {
-				log.Printf("[%s] instance scheduler already disabled", event.InstanceID)
-				return fmt.Sprintf("instance scheduler for %s already disabled", event.InstanceID), nil
-			}
-
-			// disable scheduler
-			err := createTags(ctx, client, event.InstanceID, []types.Tag{
-				{
-					Key:   aws.String(conf.ScheduleTag),
-					Value: aws.String(fmt.Sprintf("#%s", conf.ScheduleTag)),
-				},
-			})
-			if err != nil {
-				log.Printf("[%s] error disabling scheduler: %s", event.InstanceID, err)
-				return "", err
-			}
-		}
+	schedule, ok := resource.Tags[conf.ScheduleTag]
+	if !ok {
+		log.Printf("[%s] unable to find %s tag", event.InstanceID, conf.ScheduleTag)
+		return fmt.Sprintf("unable to find %s tag for %s %s", conf.ScheduleTag, event.Type, event.InstanceID), nil
+	}
+	if lib.ScheduleDisabled(schedule) {
+		log.Printf("[%s] %s scheduler already disabled", event.InstanceID, event.Type)
+		return fmt.Sprintf("%s scheduler for %s already disabled", event.Type, event.InstanceID), nil
 	}
 
-	log.Printf("[%s] instance scheduler disabled", event.InstanceID)
-	return fmt.Sprintf("instance scheduler for %s disabled", event.InstanceID), nil
-}
+	// disable scheduler
+	disableTags := map[string]string{
+		conf.ScheduleTag: lib.DisableSchedule(schedule),
+	}
+	if event.User != "" {
+		disableTags[conf.ScheduleTagDisabledBy] = event.User
+	}
+	if event.Reason != "" {
+		disableTags[conf.ScheduleTagDisabledReason] = event.Reason
+	}
 
-func createTags(ctx context.Context, client ec2ClientAPI, instanceID string, tags []types.Tag) error {
-	_, err := client.CreateTags(ctx, &ec2.CreateTagsInput{
-		Resources: []string{instanceID},
-		Tags:      tags,
-	})
+	err = driver.CreateTags(ctx, resource, disableTags)
 	if err != nil {
-		return err
+		log.Printf("[%s] error disabling scheduler: %s", event.InstanceID, err)
+		return "", err
 	}
 
-	return nil
-}
+	log.Printf("[%s] %s scheduler disabled (%s) by %q: %q", event.InstanceID, event.Type, schedule, event.User, event.Reason)
 
-func describeInstances(ctx context.Context, client ec2ClientAPI, instanceID string) (*ec2.DescribeInstancesOutput, error) {
-	resp, err := client.DescribeInstances(ctx, &ec2.DescribeInstancesInput{
-		InstanceIds: []string{instanceID},
-	})
+	err = publisher.Put(ctx, lib.NewEvent(lib.EventScheduleDisabled, lib.EventDetail{
+		Type:         event.Type,
+		InstanceID:   event.InstanceID,
+		InstanceName: resource.Name,
+		Schedule:     schedule,
+		User:         event.User,
+		Reason:       event.Reason,
+	}))
 	if err != nil {
-		return nil, err
+		log.Printf("[%s] unable to put event on %s: %s", event.InstanceID, conf.EventBus, err)
 	}
 
-	return resp, nil
+	return fmt.Sprintf("%s scheduler for %s disabled", event.Type, event.InstanceID), nil
 }
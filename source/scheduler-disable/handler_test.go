@@ -6,64 +6,137 @@ import (
 	"testing"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/service/ec2"
-	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	"github.com/caarlos0/env/v6"
+	"github.com/dwtechnologies/ec2scheduler/source/lib"
+	"github.com/dwtechnologies/ec2scheduler/source/lib/libtest"
 	"github.com/stretchr/testify/assert"
 )
 
-var _ ec2ClientAPI = (*mockEC2client)(nil)
-
-type mockEC2client struct {
-	err error
-}
-
 const instanceID = "i-07d023c826d243165"
 
-func (m *mockEC2client) DescribeInstances(ctx context.Context, params *ec2.DescribeInstancesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeInstancesOutput, error) {
-	return &ec2.DescribeInstancesOutput{
-		Reservations: []types.Reservation{},
-	}, m.err
+var _ lib.EventBridgeAPI = (*mockEventBridgeClient)(nil)
+
+type mockEventBridgeClient struct {
+	details []string
 }
 
-func (m *mockEC2client) CreateTags(ctx context.Context, params *ec2.CreateTagsInput, optFns ...func(*ec2.Options)) (*ec2.CreateTagsOutput, error) {
-	return &ec2.CreateTagsOutput{}, m.err
+func (m *mockEventBridgeClient) PutEvents(ctx context.Context, params *eventbridge.PutEventsInput, optFns ...func(*eventbridge.Options)) (*eventbridge.PutEventsOutput, error) {
+	for _, entry := range params.Entries {
+		m.details = append(m.details, aws.ToString(entry.DetailType)+" "+aws.ToString(entry.Detail))
+	}
+	return &eventbridge.PutEventsOutput{}, nil
 }
 
 func TestDisableScheduler(t *testing.T) {
+	conf := &lambdaConfig{}
+	assert.NoError(t, env.Parse(conf))
+
 	tests := []struct {
-		name        string
-		client      *mockEC2client
-		instanceID  string
-		scheduleTag string
-		err         bool
+		name     string
+		driver   *libtest.FakeDriver
+		event    inputEvent
+		want     string
+		wantTags map[string]string
+		err      bool
 	}{
 		{
-			name:        "disable scheduler",
-			client:      &mockEC2client{},
-			instanceID:  instanceID,
-			scheduleTag: "#13:00-14:00",
+			name: "disable scheduler",
+			driver: libtest.NewFakeDriver(lib.Resource{
+				Type: lib.ResourceTypeInstance, ID: instanceID,
+				Tags: map[string]string{"Schedule": "13:00-14:00"},
+			}),
+			event:    inputEvent{InstanceID: instanceID},
+			want:     fmt.Sprintf("instance scheduler for %s disabled", instanceID),
+			wantTags: map[string]string{"Schedule": "#13:00-14:00"},
+		},
+		{
+			name: "disable scheduler - user and reason",
+			driver: libtest.NewFakeDriver(lib.Resource{
+				Type: lib.ResourceTypeInstance, ID: instanceID,
+				Tags: map[string]string{"Schedule": "Mon-Fri 07:00-19:00"},
+			}),
+			event: inputEvent{InstanceID: instanceID, User: "jane", Reason: "load testing"},
+			want:  fmt.Sprintf("instance scheduler for %s disabled", instanceID),
+			wantTags: map[string]string{
+				"Schedule":               "#Mon-Fri 07:00-19:00",
+				"ScheduleDisabledBy":     "jane",
+				"ScheduleDisabledReason": "load testing",
+			},
+		},
+		{
+			name: "disable scheduler - database",
+			driver: libtest.NewFakeDriver(lib.Resource{
+				Type: lib.ResourceTypeDBInstance, ID: "orders",
+				Tags: map[string]string{"Schedule": "07:00-19:00"},
+			}),
+			event:    inputEvent{Type: lib.ResourceTypeDBInstance, InstanceID: "orders"},
+			want:     "dbInstance scheduler for orders disabled",
+			wantTags: map[string]string{"Schedule": "#07:00-19:00"},
+		},
+		{
+			name: "already disabled",
+			driver: libtest.NewFakeDriver(lib.Resource{
+				Type: lib.ResourceTypeInstance, ID: instanceID,
+				Tags: map[string]string{"Schedule": "#13:00-14:00"},
+			}),
+			event:    inputEvent{InstanceID: instanceID},
+			want:     fmt.Sprintf("instance scheduler for %s already disabled", instanceID),
+			wantTags: map[string]string{"Schedule": "#13:00-14:00"},
+		},
+		{
+			name:     "no schedule tag",
+			driver:   libtest.NewFakeDriver(lib.Resource{Type: lib.ResourceTypeInstance, ID: instanceID}),
+			event:    inputEvent{InstanceID: instanceID},
+			want:     fmt.Sprintf("unable to find Schedule tag for instance %s", instanceID),
+			wantTags: map[string]string{},
+		},
+		{
+			name:   "no instance found",
+			driver: libtest.NewFakeDriver(lib.Resource{Type: lib.ResourceTypeInstance, ID: "i-1"}),
+			event:  inputEvent{InstanceID: instanceID},
+		},
+		{
+			name:   "unknown type",
+			driver: libtest.NewFakeDriver(lib.Resource{Type: lib.ResourceTypeInstance, ID: instanceID}),
+			event:  inputEvent{Type: "bucket", InstanceID: instanceID},
+			want:   "unknown type: bucket",
 		},
 		{
 			name: "disable scheduler error",
-			client: &mockEC2client{
-				err: fmt.Errorf("error creating tags"),
+			driver: &libtest.FakeDriver{
+				Resources: []lib.Resource{{Type: lib.ResourceTypeInstance, ID: instanceID, Tags: map[string]string{"Schedule": "13:00-14:00"}}},
+				Err:       fmt.Errorf("error creating tags"),
 			},
-			instanceID:  instanceID,
-			scheduleTag: "#13:00-14:00",
-			err:         true,
+			event: inputEvent{InstanceID: instanceID},
+			err:   true,
 		},
 	}
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			err := createTags(context.Background(), test.client, test.instanceID, []types.Tag{{Key: aws.String("Schedule"), Value: aws.String(test.scheduleTag)}})
-
+			got, err := disableScheduler(context.Background(), []lib.Driver{test.driver}, nil, conf, test.event)
 			if test.err {
 				assert.Error(t, err)
 				return
 			}
 
 			assert.NoError(t, err)
+			assert.Equal(t, test.want, got)
+			if test.wantTags != nil {
+				assert.Equal(t, test.wantTags, test.driver.Tags(test.driver.Resources[0].ID))
+			}
 		})
 	}
 }
+
+func TestDisableSchedulerEvent(t *testing.T) {
+	conf := &lambdaConfig{}
+	assert.NoError(t, env.Parse(conf))
+
+	events := &mockEventBridgeClient{}
+	driver := libtest.NewFakeDriver(lib.Resource{Type: lib.ResourceTypeInstance, ID: instanceID, Tags: map[string]string{"Schedule": "13:00-14:00"}})
+	_, err := disableScheduler(context.Background(), []lib.Driver{driver}, lib.NewEventPublisher(events, "default"), conf, inputEvent{InstanceID: instanceID, User: "jane"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{`ScheduleDisabled {"type":"instance","instanceId":"i-07d023c826d243165","schedule":"13:00-14:00","user":"jane"}`}, events.details)
+}
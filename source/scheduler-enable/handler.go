@@ -0,0 +1,132 @@
+package main
+
+// Enable scheduler, restore the schedule commented out by ec2scheduler-disable
+// event:
+// { "instanceId": "i-00e92a5a9cb7eeb4d" }
+// { "type": "dbInstance", "instanceId": "orders" }
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	"github.com/caarlos0/env/v6"
+	"github.com/dwtechnologies/ec2scheduler/source/lib"
+)
+
+type inputEvent struct {
+	// instance (default), autoScalingGroup, dbInstance, dbCluster or ecsService (cluster/service)
+	Type       string `json:"type"`
+	InstanceID string `json:"instanceId"`
+}
+
+type lambdaConfig struct {
+	lib.TagConfig
+	lib.EventConfig
+}
+
+func main() {
+	lambda.Start(handler)
+}
+
+func handler(ctx context.Context, event inputEvent) (string, error) {
+	// parse env variables
+	conf := &lambdaConfig{}
+	if err := env.Parse(conf); err != nil {
+		log.Printf("%s", err)
+		return "", err
+	}
+
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	drivers := lib.NewDrivers(cfg, cfg.Region, conf.TagConfig)
+	publisher := lib.NewEventPublisher(eventbridge.NewFromConfig(cfg), conf.EventBus)
+
+	return enableScheduler(ctx, drivers, publisher, conf, event)
+}
+
+// uncomment scheduleTag of the event resource and remove who disabled it and why
+// a suspended scheduler is left to ec2scheduler-unsuspend
+func enableScheduler(ctx context.Context, drivers []lib.Driver, publisher *lib.EventPublisher, conf *lambdaConfig, event inputEvent) (string, error) {
+	if event.Type == "" {
+		event.Type = lib.ResourceTypeInstance
+	}
+	driver := lib.DriverOf(drivers, event.Type)
+	if driver == nil {
+		log.Printf("[%s] unknown type %s", event.InstanceID, event.Type)
+		return fmt.Sprintf("unknown type: %s", event.Type), nil
+	}
+
+	resource, err := driver.Get(ctx, event.Type, event.InstanceID)
+	if errors.Is(err, lib.ErrNotFound) {
+		log.Printf("[%s] no %s found", event.InstanceID, event.Type)
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	tags := resource.Tags
+	schedule, ok := tags[conf.ScheduleTag]
+	if !ok {
+		log.Printf("[%s] unable to find %s tag", event.InstanceID, conf.ScheduleTag)
+		return fmt.Sprintf("unable to find %s tag for %s %s", conf.ScheduleTag, event.Type, event.InstanceID), nil
+	}
+	if !lib.ScheduleDisabled(schedule) {
+		log.Printf("[%s] %s scheduler already enabled", event.InstanceID, event.Type)
+		return fmt.Sprintf("%s scheduler for %s already enabled", event.Type, event.InstanceID), nil
+	}
+	if suspendUntil, ok := tags[conf.ScheduleTagSuspend]; ok {
+		log.Printf("[%s] %s scheduler suspended until %s", event.InstanceID, event.Type, suspendUntil)
+		return fmt.Sprintf("%s scheduler for %s suspended until %s, unsuspend it instead", event.Type, event.InstanceID, suspendUntil), nil
+	}
+
+	// disabled with the legacy value (#Schedule), nothing to restore
+	if err := lib.ValidateSchedule(lib.EnableSchedule(schedule)); err != nil {
+		log.Printf("[%s] disabled schedule %s can't be restored: %s", event.InstanceID, schedule, err)
+		return fmt.Sprintf("%s scheduler for %s can't be enabled, %s is not a valid schedule: set it instead", event.Type, event.InstanceID, lib.EnableSchedule(schedule)), nil
+	}
+
+	// enable scheduler
+	err = driver.CreateTags(ctx, resource, map[string]string{
+		conf.ScheduleTag: lib.EnableSchedule(schedule),
+	})
+	if err != nil {
+		log.Printf("[%s] error enabling scheduler: %s", event.InstanceID, err)
+		return "", err
+	}
+
+	// remove who disabled the scheduler and why
+	disabledTags := []string{}
+	for _, key := range []string{conf.ScheduleTagDisabledBy, conf.ScheduleTagDisabledReason} {
+		if _, ok := tags[key]; ok {
+			disabledTags = append(disabledTags, key)
+		}
+	}
+	if len(disabledTags) > 0 {
+		if err := driver.DeleteTags(ctx, resource, disabledTags...); err != nil {
+			log.Printf("[%s] unable to remove tags %s: %s", event.InstanceID, disabledTags, err)
+		}
+	}
+
+	log.Printf("[%s] %s scheduler enabled (%s)", event.InstanceID, event.Type, lib.EnableSchedule(schedule))
+
+	err = publisher.Put(ctx, lib.NewEvent(lib.EventScheduleEnabled, lib.EventDetail{
+		Type:         event.Type,
+		InstanceID:   event.InstanceID,
+		InstanceName: resource.Name,
+		Schedule:     lib.EnableSchedule(schedule),
+	}))
+	if err != nil {
+		log.Printf("[%s] unable to put event on %s: %s", event.InstanceID, conf.EventBus, err)
+	}
+
+	return fmt.Sprintf("%s scheduler for %s enabled: %s", event.Type, event.InstanceID, lib.EnableSchedule(schedule)), nil
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/caarlos0/env/v6"
+	"github.com/dwtechnologies/ec2scheduler/source/lib"
+	"github.com/dwtechnologies/ec2scheduler/source/lib/libtest"
+	"github.com/stretchr/testify/assert"
+)
+
+const instanceID = "i-07d023c826d243165"
+
+func TestEnableScheduler(t *testing.T) {
+	conf := &lambdaConfig{}
+	assert.NoError(t, env.Parse(conf))
+
+	tests := []struct {
+		name     string
+		driver   *libtest.FakeDriver
+		event    inputEvent
+		want     string
+		wantTags map[string]string
+		err      bool
+	}{
+		{
+			name: "enable scheduler",
+			driver: libtest.NewFakeDriver(lib.Resource{
+				Type: lib.ResourceTypeInstance, ID: instanceID,
+				Tags: map[string]string{"Schedule": "#Mon-Fri 07:00-19:00"},
+			}),
+			event:    inputEvent{InstanceID: instanceID},
+			want:     fmt.Sprintf("instance scheduler for %s enabled: Mon-Fri 07:00-19:00", instanceID),
+			wantTags: map[string]string{"Schedule": "Mon-Fri 07:00-19:00"},
+		},
+		{
+			name: "enable scheduler - remove disabled by and reason",
+			driver: libtest.NewFakeDriver(lib.Resource{
+				Type: lib.ResourceTypeInstance, ID: instanceID,
+				Tags: map[string]string{
+					"Schedule":               "#13:00-14:00",
+					"ScheduleDisabledBy":     "jane",
+					"ScheduleDisabledReason": "load testing",
+				},
+			}),
+			event:    inputEvent{InstanceID: instanceID},
+			want:     fmt.Sprintf("instance scheduler for %s enabled: 13:00-14:00", instanceID),
+			wantTags: map[string]string{"Schedule": "13:00-14:00"},
+		},
+		{
+			name: "enable scheduler - Auto Scaling group",
+			driver: libtest.NewFakeDriver(lib.Resource{
+				Type: lib.ResourceTypeAutoScalingGroup, ID: "web",
+				Tags: map[string]string{"Schedule": "#07:00-19:00"},
+			}),
+			event:    inputEvent{Type: lib.ResourceTypeAutoScalingGroup, InstanceID: "web"},
+			want:     "autoScalingGroup scheduler for web enabled: 07:00-19:00",
+			wantTags: map[string]string{"Schedule": "07:00-19:00"},
+		},
+		{
+			name: "already enabled",
+			driver: libtest.NewFakeDriver(lib.Resource{
+				Type: lib.ResourceTypeInstance, ID: instanceID,
+				Tags: map[string]string{"Schedule": "13:00-14:00"},
+			}),
+			event:    inputEvent{InstanceID: instanceID},
+			want:     fmt.Sprintf("instance scheduler for %s already enabled", instanceID),
+			wantTags: map[string]string{"Schedule": "13:00-14:00"},
+		},
+		{
+			name: "suspended",
+			driver: libtest.NewFakeDriver(lib.Resource{
+				Type: lib.ResourceTypeInstance, ID: instanceID,
+				Tags: map[string]string{"Schedule": "#13:00-14:00", "ScheduleSuspendUntil": "20210401"},
+			}),
+			event:    inputEvent{InstanceID: instanceID},
+			want:     fmt.Sprintf("instance scheduler for %s suspended until 20210401, unsuspend it instead", instanceID),
+			wantTags: map[string]string{"Schedule": "#13:00-14:00", "ScheduleSuspendUntil": "20210401"},
+		},
+		{
+			name: "legacy disabled value",
+			driver: libtest.NewFakeDriver(lib.Resource{
+				Type: lib.ResourceTypeInstance, ID: instanceID,
+				Tags: map[string]string{"Schedule": "#Schedule"},
+			}),
+			event:    inputEvent{InstanceID: instanceID},
+			want:     fmt.Sprintf("instance scheduler for %s can't be enabled, Schedule is not a valid schedule: set it instead", instanceID),
+			wantTags: map[string]string{"Schedule": "#Schedule"},
+		},
+		{
+			name: "no schedule tag",
+			driver: libtest.NewFakeDriver(lib.Resource{
+				Type: lib.ResourceTypeInstance, ID: instanceID,
+				Tags: map[string]string{"Name": "web-1"},
+			}),
+			event:    inputEvent{InstanceID: instanceID},
+			want:     fmt.Sprintf("unable to find Schedule tag for instance %s", instanceID),
+			wantTags: map[string]string{"Name": "web-1"},
+		},
+		{
+			name:   "no instance found",
+			driver: libtest.NewFakeDriver(lib.Resource{Type: lib.ResourceTypeInstance, ID: "i-1"}),
+			event:  inputEvent{InstanceID: instanceID},
+		},
+		{
+			name:   "unknown type",
+			driver: libtest.NewFakeDriver(lib.Resource{Type: lib.ResourceTypeInstance, ID: instanceID}),
+			event:  inputEvent{Type: "bucket", InstanceID: instanceID},
+			want:   "unknown type: bucket",
+		},
+		{
+			name: "enable scheduler error",
+			driver: &libtest.FakeDriver{
+				Resources: []lib.Resource{{Type: lib.ResourceTypeInstance, ID: instanceID, Tags: map[string]string{"Schedule": "#13:00-14:00"}}},
+				Err:       fmt.Errorf("error creating tags"),
+			},
+			event: inputEvent{InstanceID: instanceID},
+			err:   true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := enableScheduler(context.Background(), []lib.Driver{test.driver}, nil, conf, test.event)
+			if test.err {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, test.want, got)
+			if test.wantTags != nil {
+				assert.Equal(t, test.wantTags, test.driver.Tags(test.driver.Resources[0].ID))
+			}
+		})
+	}
+}
@@ -7,5 +7,9 @@ require (
 	github.com/aws/aws-sdk-go-v2 v1.1.0
 	github.com/aws/aws-sdk-go-v2/config v1.1.0
 	github.com/aws/aws-sdk-go-v2/service/ec2 v1.1.0
+	github.com/aws/aws-sdk-go-v2/service/eventbridge v1.1.0
 	github.com/caarlos0/env/v6 v6.4.0
+	github.com/dwtechnologies/ec2scheduler/source/lib v0.0.0
 )
+
+replace github.com/dwtechnologies/ec2scheduler/source/lib => ../lib
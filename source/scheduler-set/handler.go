@@ -4,14 +4,16 @@ import (
 	"context"
 	"fmt"
 	"log"
-	"regexp"
+	"strings"
 
 	"github.com/aws/aws-lambda-go/lambda"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/ec2"
 	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
 	"github.com/caarlos0/env/v6"
+	"github.com/dwtechnologies/ec2scheduler/source/lib"
 )
 
 type inputEvent struct {
@@ -21,12 +23,10 @@ type inputEvent struct {
 }
 
 type lambdaConfig struct {
-	ScheduleTag    string `env:"SCHEDULE_TAG" envDefault:"Schedule"`
-	ScheduleTagDay string `env:"SCHEDULE_TAG_DAY" envDefault:"ScheduleDay"`
+	lib.TagConfig
+	lib.EventConfig
 }
 
-const rangeTimeRegexp = `#?\d{2}:\d{2}-\d{2}:\d{2}`
-
 func main() {
 	lambda.Start(handler)
 }
@@ -39,15 +39,32 @@ func handler(ctx context.Context, event inputEvent) (string, error) {
 		return "", err
 	}
 
-	matched, err := regexp.Match(rangeTimeRegexp, []byte(event.RangeTime))
+	cfg, err := config.LoadDefaultConfig(ctx)
 	if err != nil {
 		return "", err
 	}
+	client := ec2.NewFromConfig(cfg)
+	publisher := lib.NewEventPublisher(eventbridge.NewFromConfig(cfg), conf.EventBus)
 
-	if !matched {
-		log.Printf("invalid time range: %s", event.RangeTime)
+	// same syntax check as the scheduler engine: cron expressions or time windows
+	event.RangeTime = strings.TrimSpace(event.RangeTime)
+	// disabling belongs to ec2scheduler-disable, it records who and why
+	if lib.ScheduleDisabled(event.RangeTime) {
+		log.Printf("disabled time range %s", event.RangeTime)
+		return fmt.Sprintf("time range %s is commented out, use ec2scheduler-disable instead", event.RangeTime), nil
+	}
+	if err := lib.ValidateSchedule(event.RangeTime); err != nil {
+		log.Printf("invalid time range %s: %s", event.RangeTime, err)
+		putEvent(ctx, publisher, conf, lib.EventScheduleInvalid, event, err)
 		return fmt.Sprintf("invalid time range: %s", event.RangeTime), nil
 	}
+	if event.RangeWeekdays != "" {
+		if _, err := lib.ParseScheduleDay(event.RangeWeekdays); err != nil {
+			log.Printf("invalid weekdays %s: %s", event.RangeWeekdays, err)
+			putEvent(ctx, publisher, conf, lib.EventScheduleInvalid, event, err)
+			return fmt.Sprintf("invalid weekdays: %s", event.RangeWeekdays), nil
+		}
+	}
 
 	// tags
 	tags := []types.Tag{}
@@ -62,30 +79,28 @@ func handler(ctx context.Context, event inputEvent) (string, error) {
 		})
 	}
 
-	cfg, err := config.LoadDefaultConfig(ctx)
-	if err != nil {
-		return "", err
-	}
-	client := ec2.NewFromConfig(cfg)
-
 	// set tags
-	err = createTags(ctx, client, event.InstanceID, tags)
+	err = lib.CreateTags(ctx, client, event.InstanceID, tags)
 	if err != nil {
 		return "", err
 	}
 
 	log.Printf("scheduler set for instance %s. rangeTime: %s, rangeWeekdays: %s", event.InstanceID, event.RangeTime, event.RangeWeekdays)
+	putEvent(ctx, publisher, conf, lib.EventScheduleSet, event, nil)
 	return fmt.Sprintf("scheduler set for instance %s: %s", event.InstanceID, event.RangeTime), nil
 }
 
-func createTags(ctx context.Context, client *ec2.Client, instanceID string, tags []types.Tag) error {
-	_, err := client.CreateTags(ctx, &ec2.CreateTagsInput{
-		Resources: []string{instanceID},
-		Tags:      tags,
-	})
+// put a ScheduleSet/ScheduleInvalid event of the requested schedule, err is the validation error
+func putEvent(ctx context.Context, publisher *lib.EventPublisher, conf *lambdaConfig, detailType string, event inputEvent, err error) {
+	detail := lib.EventDetail{
+		InstanceID: event.InstanceID,
+		Schedule:   event.RangeTime,
+	}
 	if err != nil {
-		return err
+		detail.Error = err.Error()
 	}
 
-	return nil
+	if err := publisher.Put(ctx, lib.NewEvent(detailType, detail)); err != nil {
+		log.Printf("unable to put event on %s: %s", conf.EventBus, err)
+	}
 }
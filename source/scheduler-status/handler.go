@@ -6,13 +6,20 @@ import (
 	"fmt"
 	"html/template"
 	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/aws/aws-lambda-go/lambda"
-	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/ec2"
-	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/organizations"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
 	"github.com/caarlos0/env/v6"
+	"github.com/dwtechnologies/ec2scheduler/source/lib"
 )
 
 type inputEvent struct {
@@ -20,35 +27,128 @@ type inputEvent struct {
 	Filter string `json:"filter"`
 }
 type instanceData struct {
+	Account         string
+	Region          string
+	Type            string
 	InstanceID      string
 	InstanceName    string
 	State           string
 	Schedule        string
+	ScheduleRules   []string
 	ScheduleDay     string
+	ScheduleTZ      string
+	ScheduleFrom    string
+	ScheduleUntil   string
 	ScheduleSuspend string
+	SuspendMode     string
+	DisabledBy      string
+	DisabledReason  string
 	ScheduleSNS     string
+	ScheduleCal     string
+	NextHoliday     string
+}
+
+// described resources, and the regions (account/region cross-account, region/type for a resource type alone)
+// and accounts that couldn't be described, and why
+type statusResult struct {
+	Instances     []instanceData
+	RegionErrors  map[string]string
+	AccountErrors map[string]string
+}
+
+func newStatusResult() *statusResult {
+	return &statusResult{
+		Instances:     []instanceData{},
+		RegionErrors:  map[string]string{},
+		AccountErrors: map[string]string{},
+	}
+}
+
+// add the result of an account, empty for the Lambda account
+func (r *statusResult) mergeAccount(account string, other *statusResult) {
+	r.Instances = append(r.Instances, other.Instances...)
+	for region, err := range other.RegionErrors {
+		if account != "" {
+			region = account + "/" + region
+		}
+		r.RegionErrors[region] = err
+	}
+}
+
+// what couldn't be described, sorted, the output would look complete without it
+func (r *statusResult) Errors() []string {
+	errs := []string{}
+	for account, err := range r.AccountErrors {
+		errs = append(errs, fmt.Sprintf("account %s: %s", account, err))
+	}
+	for region, err := range r.RegionErrors {
+		errs = append(errs, fmt.Sprintf("region %s: %s", region, err))
+	}
+	sort.Strings(errs)
+
+	return errs
 }
 
 type lambdaConfig struct {
-	ScheduleTag        string `env:"SCHEDULE_TAG" envDefault:"Schedule"`
-	ScheduleTagDay     string `env:"SCHEDULE_TAG_DAY" envDefault:"ScheduleDay"`
-	ScheduleTagSuspend string `env:"SCHEDULE_TAG_SUSPEND" envDefault:"ScheduleSuspendUntil"`
-	ScheduleTagSNS     string `env:"SCHEDULE_TAG_SNS" envDefault:"ScheduleSNS"`
+	lib.TagConfig
+	lib.RegionConfig
+	lib.AccountConfig
+	lib.CalendarConfig
 }
 
-var teamsOutputTmpl = `{{ range . -}}
-▸ **{{ .InstanceID }}** {{ if ne .InstanceName "" }}[{{ .InstanceName }}]{{ end }}
+var teamsOutputTmpl = `{{ range .Instances -}}
+▸ **{{ .InstanceID }}** {{ if and (ne .InstanceName "") (ne .InstanceName .InstanceID) }}[{{ .InstanceName }}]{{ end }}
+{{ if ne .Type "instance" -}}
+Type: {{ .Type }}
+{{ end -}}
+{{ if ne .Account "" -}}
+Account: {{ .Account }}
+{{ end -}}
+Region: {{ .Region }}
 State: {{ .State }}
+{{ if gt (len .ScheduleRules) 1 -}}
+Schedule:
+{{ range .ScheduleRules }}- {{ . }}
+{{ end -}}
+{{ else -}}
 Schedule: {{ .Schedule }}
+{{ end -}}
 {{ if ne .ScheduleDay "" -}}
 ScheduleDay: {{ .ScheduleDay }}
 {{ end -}}
+{{ if ne .ScheduleTZ "" -}}
+ScheduleTimezone: {{ .ScheduleTZ }}
+{{ end -}}
+{{ if ne .ScheduleFrom "" -}}
+ScheduleFrom: {{ .ScheduleFrom }}
+{{ end -}}
+{{ if ne .ScheduleUntil "" -}}
+ScheduleUntil: {{ .ScheduleUntil }}
+{{ end -}}
 {{ if ne .ScheduleSuspend "" -}}
 ScheduleSuspend: {{ .ScheduleSuspend }}
 {{ end -}}
+{{ if ne .SuspendMode "" -}}
+ScheduleSuspendMode: {{ .SuspendMode }}
+{{ end -}}
+{{ if ne .DisabledBy "" -}}
+DisabledBy: {{ .DisabledBy }}
+{{ end -}}
+{{ if ne .DisabledReason "" -}}
+DisabledReason: {{ .DisabledReason }}
+{{ end -}}
 {{ if ne .ScheduleSNS "" -}}
 ScheduleSNS: {{ .ScheduleSNS }}
+{{ end -}}
+{{ if ne .ScheduleCal "" -}}
+ScheduleCalendar: {{ .ScheduleCal }}
+{{ end -}}
+{{ if ne .NextHoliday "" -}}
+NextHoliday: {{ .NextHoliday }}
 {{ end }}
+{{ end -}}
+{{ range .Errors -}}
+⚠ unable to describe {{ . }}
 {{ end }}`
 
 func main() {
@@ -67,76 +167,181 @@ func handler(ctx context.Context, event inputEvent) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	client := ec2.NewFromConfig(cfg)
-
-	resp, err := client.DescribeInstances(ctx, &ec2.DescribeInstancesInput{
-		Filters: []types.Filter{
-			{
-				Name:   aws.String("instance-state-name"),
-				Values: []string{"running", "stopped"},
-			},
-			{
-				Name:   aws.String("tag-key"),
-				Values: []string{conf.ScheduleTag},
-			},
-			{
-				Name:   aws.String("tag:Name"),
-				Values: []string{fmt.Sprintf("*%s*", event.Filter)},
-			},
-		},
+	calendars := lib.NewCalendarStore(s3.NewFromConfig(cfg), ssm.NewFromConfig(cfg), conf.CalendarConfig)
+
+	accounts, err := lib.ParseAccounts(ctx, conf.AccountConfig, ssm.NewFromConfig(cfg), organizations.NewFromConfig(cfg))
+	if err != nil {
+		return "", err
+	}
+	stsClient := sts.NewFromConfig(cfg)
+
+	// every account and region concurrently, a failing one doesn't affect the others
+	var mu sync.Mutex
+	result := newStatusResult()
+	errs := lib.ForEachAccount(ctx, accounts, func(ctx context.Context, account lib.Account) error {
+		accountCfg := lib.AccountAWSConfig(cfg, stsClient, account)
+
+		regions, err := lib.ParseRegions(ctx, ec2.NewFromConfig(accountCfg), conf.Regions, cfg.Region)
+		if err != nil {
+			return err
+		}
+
+		drivers := func(region string) []lib.Driver {
+			return lib.NewDrivers(accountCfg, region, conf.TagConfig)
+		}
+		accountResult, err := describeAccount(ctx, conf, drivers, regions, calendars, event, account.ID)
+		if err != nil {
+			return err
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		result.mergeAccount(account.ID, accountResult)
+		return nil
 	})
+	for account, err := range errs {
+		result.AccountErrors[account] = err.Error()
+	}
+	// nothing described at all
+	if len(errs) == len(accounts) {
+		return "", errs[accounts[0].ID]
+	}
 
-	if len(resp.Reservations) < 1 {
+	if len(result.Instances) < 1 && len(result.Errors()) < 1 {
 		log.Printf("no scheduled instances")
 		return "", nil
 	}
 
-	instancesData := []instanceData{}
-	for _, reservation := range resp.Reservations {
-		instance := reservation.Instances[0]
+	// accounts and regions finish in any order
+	sort.SliceStable(result.Instances, func(i, j int) bool {
+		return result.Instances[i].Account+result.Instances[i].Region < result.Instances[j].Account+result.Instances[j].Region
+	})
 
-		d := &instanceData{}
-		d.InstanceID = *instance.InstanceId
-		d.State = fmt.Sprintf("%s", instance.State.Name)
+	log.Printf("%+v", result)
+
+	switch event.Format {
+	case "teams":
+		return teamsResponse(result)
+	}
 
-		for _, tag := range instance.Tags {
-			if *tag.Key == "Name" {
-				d.InstanceName = *tag.Value
-			}
+	// event.Format: text
+	return textResponse(result), nil
+}
 
-			if *tag.Key == conf.ScheduleTag {
-				d.Schedule = *tag.Value
-			}
+// describe the resources of every region of an account, drivers returns the drivers of a region
+// a failing region is listed in RegionErrors, the account fails if all of them do
+func describeAccount(ctx context.Context, conf *lambdaConfig, drivers func(region string) []lib.Driver, regions []string, calendars *lib.CalendarStore, event inputEvent, account string) (*statusResult, error) {
+	result := newStatusResult()
 
-			if *tag.Key == conf.ScheduleTagDay {
-				d.ScheduleDay = *tag.Value
-			}
+	var mu sync.Mutex
+	errs := lib.ForEachRegion(ctx, regions, func(ctx context.Context, region string) error {
+		regionResult, err := describeRegion(ctx, conf, drivers(region), calendars, event, account, region)
+		if err != nil {
+			return err
+		}
 
-			if *tag.Key == conf.ScheduleTagSuspend {
-				d.ScheduleSuspend = *tag.Value
-			}
+		mu.Lock()
+		defer mu.Unlock()
+		result.mergeAccount("", regionResult)
+		return nil
+	})
+	for region, err := range errs {
+		result.RegionErrors[region] = err.Error()
+	}
+	if len(regions) > 0 && len(errs) == len(regions) {
+		return nil, errs[regions[0]]
+	}
+
+	return result, nil
+}
+
+// scheduled resources of region, of every driver, with a Name matching event.Filter
+// account is the id of the assumed account, empty for the Lambda one
+// a driver failing alone is listed in RegionErrors (region/type), the region fails if all of them do
+func describeRegion(ctx context.Context, conf *lambdaConfig, drivers []lib.Driver, calendars *lib.CalendarStore, event inputEvent, account, region string) (*statusResult, error) {
+	result := newStatusResult()
+
+	resources, errs := lib.ListResources(ctx, drivers, conf.ScheduleTag)
+	if len(drivers) > 0 && len(errs) == len(drivers) {
+		return nil, errs[drivers[0]]
+	}
+	for driver, err := range errs {
+		result.RegionErrors[region+"/"+strings.Join(driver.Types(), ",")] = err.Error()
+	}
 
-			if *tag.Key == conf.ScheduleTagSNS {
-				d.ScheduleSNS = *tag.Value
-			}
+	for _, r := range resources {
+		if !strings.Contains(r.Name, event.Filter) {
+			continue
 		}
 
-		instancesData = append(instancesData, *d)
+		tags := r.Tags
+		d := &instanceData{
+			Account:         account,
+			Region:          region,
+			Type:            r.Type,
+			InstanceID:      r.ID,
+			InstanceName:    r.Name,
+			State:           string(r.State),
+			Schedule:        tags[conf.ScheduleTag],
+			ScheduleRules:   lib.ScheduleRules(tags[conf.ScheduleTag]),
+			ScheduleDay:     tags[conf.ScheduleTagDay],
+			ScheduleTZ:      tags[conf.ScheduleTagTZ],
+			ScheduleFrom:    tags[conf.ScheduleTagFrom],
+			ScheduleUntil:   tags[conf.ScheduleTagUntil],
+			ScheduleSuspend: tags[conf.ScheduleTagSuspend],
+			SuspendMode:     tags[conf.ScheduleTagSuspendMode],
+			DisabledBy:      tags[conf.ScheduleTagDisabledBy],
+			DisabledReason:  tags[conf.ScheduleTagDisabledReason],
+			ScheduleSNS:     tags[conf.ScheduleTagSNS],
+			ScheduleCal:     tags[conf.ScheduleTagCalendar],
+		}
+
+		// next holiday affecting the instance, in the instance timezone
+		if d.ScheduleCal != "" {
+			d.NextHoliday = nextHoliday(ctx, calendars, d.ScheduleCal, d.ScheduleTZ)
+		}
+
+		result.Instances = append(result.Instances, *d)
 	}
 
-	log.Printf("%+v", instancesData)
+	if len(result.Instances) < 1 {
+		log.Printf("[%s] no scheduled instances", region)
+	}
 
-	switch event.Format {
-	case "teams":
-		return teamsResponse(instancesData)
+	return result, nil
+}
+
+// next holiday in the calendar, its date only
+// the calendar content is picked by a tag, none of it is echoed
+func nextHoliday(ctx context.Context, calendars *lib.CalendarStore, ref, timezone string) string {
+	cal, err := calendars.Load(ctx, ref)
+	if err != nil {
+		log.Printf("unable to load calendar %s: %s", ref, err)
+		return fmt.Sprintf("unable to load calendar: %s", err)
 	}
 
-	// event.Format: text
-	return fmt.Sprintf("%+v", instancesData), nil
+	location, _ := lib.LoadLocation(timezone)
+
+	date, _, ok := cal.NextHoliday(time.Now().In(location))
+	if !ok {
+		return ""
+	}
+
+	return date.Format("2006-01-02")
+}
+
+// instances, then what couldn't be described, a line each
+func textResponse(result *statusResult) string {
+	lines := []string{fmt.Sprintf("%+v", result.Instances)}
+	for _, err := range result.Errors() {
+		lines = append(lines, "unable to describe "+err)
+	}
+
+	return strings.Join(lines, "\n")
 }
 
 // parse Teams response
-func teamsResponse(response []instanceData) (string, error) {
+func teamsResponse(response *statusResult) (string, error) {
 	t, _ := template.New("output").Parse(teamsOutputTmpl)
 	var pp bytes.Buffer
 	if err := t.Execute(&pp, response); err != nil {
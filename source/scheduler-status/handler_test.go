@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/caarlos0/env/v6"
+	"github.com/dwtechnologies/ec2scheduler/source/lib"
+	"github.com/dwtechnologies/ec2scheduler/source/lib/libtest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDescribeAccount(t *testing.T) {
+	conf := &lambdaConfig{}
+	assert.NoError(t, env.Parse(conf))
+	calendars := lib.NewCalendarStore(nil, nil, lib.CalendarConfig{})
+
+	// eu-west-1 can't list its databases, eu-north-1 is denied by an SCP
+	instance := lib.Resource{Type: lib.ResourceTypeInstance, ID: "i-1", Name: "web-1", State: lib.StateRunning, Tags: map[string]string{"Schedule": "07:00-19:00"}}
+	rdsDriver := libtest.NewFakeDriver(lib.Resource{Type: lib.ResourceTypeDBInstance, ID: "orders"})
+	rdsDriver.Err = fmt.Errorf("AccessDenied")
+	drivers := map[string][]lib.Driver{
+		"eu-west-1":  {libtest.NewFakeDriver(instance), rdsDriver},
+		"eu-north-1": {&libtest.FakeDriver{Err: fmt.Errorf("UnauthorizedOperation")}},
+	}
+	newDrivers := func(region string) []lib.Driver {
+		return drivers[region]
+	}
+
+	result, err := describeAccount(context.Background(), conf, newDrivers, []string{"eu-west-1", "eu-north-1"}, calendars, inputEvent{}, "111111111111")
+	assert.NoError(t, err)
+	assert.Len(t, result.Instances, 1)
+	assert.Equal(t, "i-1", result.Instances[0].InstanceID)
+	assert.Equal(t, "111111111111", result.Instances[0].Account)
+	assert.Equal(t, map[string]string{
+		"eu-west-1/dbInstance": "AccessDenied",
+		"eu-north-1":           "UnauthorizedOperation",
+	}, result.RegionErrors)
+
+	// no region at all, the account fails
+	_, err = describeAccount(context.Background(), conf, newDrivers, []string{"eu-north-1"}, calendars, inputEvent{}, "111111111111")
+	assert.EqualError(t, err, "UnauthorizedOperation")
+}
+
+var _ lib.S3ClientAPI = (*mockS3client)(nil)
+
+type mockS3client struct {
+	objects map[string]string
+}
+
+func (m *mockS3client) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	object, ok := m.objects[aws.ToString(params.Bucket)+"/"+aws.ToString(params.Key)]
+	if !ok {
+		return nil, fmt.Errorf("NoSuchKey")
+	}
+	return &s3.GetObjectOutput{Body: ioutil.NopCloser(strings.NewReader(object))}, nil
+}
+
+func TestNextHoliday(t *testing.T) {
+	next := time.Now().UTC().AddDate(0, 0, 2).Format("2006-01-02")
+	calendars := lib.NewCalendarStore(&mockS3client{objects: map[string]string{
+		"calendars/se.txt": next + " something read from the bucket",
+	}}, nil, lib.CalendarConfig{})
+
+	// the date only, nothing else of the calendar
+	assert.Equal(t, next, nextHoliday(context.Background(), calendars, "s3://calendars/se.txt", "UTC"))
+	assert.Contains(t, nextHoliday(context.Background(), calendars, "/var/task/main", "UTC"), "unable to load calendar")
+}
+
+func TestStatusResponse(t *testing.T) {
+	result := newStatusResult()
+	result.mergeAccount("111111111111", &statusResult{
+		Instances:    []instanceData{{Account: "111111111111", Region: "eu-west-1", Type: lib.ResourceTypeInstance, InstanceID: "i-1", State: "running"}},
+		RegionErrors: map[string]string{"eu-north-1": "UnauthorizedOperation"},
+	})
+	result.AccountErrors["222222222222"] = "AccessDenied"
+
+	// the missing account and region are part of the output
+	want := []string{
+		"unable to describe account 222222222222: AccessDenied",
+		"unable to describe region 111111111111/eu-north-1: UnauthorizedOperation",
+	}
+	text := textResponse(result)
+	teams, err := teamsResponse(result)
+	assert.NoError(t, err)
+	for _, line := range want {
+		assert.Contains(t, text, line)
+		assert.Contains(t, teams, line)
+	}
+	assert.Contains(t, teams, "**i-1**")
+}
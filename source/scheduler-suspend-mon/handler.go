@@ -2,29 +2,23 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"log"
-	"strings"
+	"sync"
 	"time"
 
 	"github.com/aws/aws-lambda-go/lambda"
-	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/ec2"
-	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
 	"github.com/caarlos0/env/v6"
+	"github.com/dwtechnologies/ec2scheduler/source/lib"
 )
 
 type lambdaConfig struct {
-	ScheduleTag        string `env:"SCHEDULE_TAG" envDefault:"Schedule"`
-	ScheduleTagSuspend string `env:"SCHEDULE_TAG_SUSPEND" envDefault:"ScheduleSuspendUntil"`
-}
-
-var scheduleTagSuspendLayouts = map[int]string{
-	4:  "2006",
-	6:  "200601",
-	8:  "20060102",
-	11: "20060102T15",
-	14: "20060102T15:04",
+	lib.TagConfig
+	lib.EventConfig
+	lib.RegionConfig
 }
 
 func main() {
@@ -43,99 +37,106 @@ func handler(ctx context.Context) error {
 	if err != nil {
 		return err
 	}
-	client := ec2.NewFromConfig(cfg)
-
-	resp, err := client.DescribeInstances(ctx, &ec2.DescribeInstancesInput{
-		Filters: []types.Filter{
-			{
-				Name:   aws.String("instance-state-name"),
-				Values: []string{"running", "stopped"},
-			},
-			{
-				Name:   aws.String("tag-key"),
-				Values: []string{conf.ScheduleTagSuspend},
-			},
-		},
-	})
+	publisher := lib.NewEventPublisher(eventbridge.NewFromConfig(cfg), conf.EventBus)
+
+	regions, err := lib.ParseRegions(ctx, ec2.NewFromConfig(cfg), conf.Regions, cfg.Region)
 	if err != nil {
 		return err
 	}
 
-	if len(resp.Reservations) < 1 {
-		log.Printf("no instance found")
+	// every region concurrently, a failing region doesn't affect the others
+	var mu sync.Mutex
+	events := []lib.Event{}
+	errs := lib.ForEachRegion(ctx, regions, func(ctx context.Context, region string) error {
+		drivers := lib.NewDrivers(cfg, region, conf.TagConfig)
+
+		regionEvents, err := unsuspendRegion(ctx, conf, drivers, region)
+		if err != nil {
+			return err
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, regionEvents...)
 		return nil
+	})
+
+	if err := publisher.Put(ctx, events...); err != nil {
+		log.Printf("unable to put events on %s: %s", conf.EventBus, err)
+	}
+
+	// nothing checked at all
+	if len(regions) > 0 && len(errs) == len(regions) {
+		return errs[regions[0]]
 	}
 
-	for _, reservation := range resp.Reservations {
-		instance := reservation.Instances[0]
-		tags := map[string]string{}
-		for _, tag := range instance.Tags {
-			tags[*tag.Key] = *tag.Value
+	log.Printf("done and dusted")
+	return nil
+}
+
+// unsuspend the resources of region whose suspension expired, whatever their type
+// return the events to put on the EventBridge bus
+func unsuspendRegion(ctx context.Context, conf *lambdaConfig, drivers []lib.Driver, region string) ([]lib.Event, error) {
+	// a driver failing alone is logged, the resources of the others are still gone through
+	resources, errs := lib.ListResources(ctx, drivers, conf.ScheduleTagSuspend)
+	if len(drivers) > 0 && len(errs) == len(drivers) {
+		return nil, errs[drivers[0]]
+	}
+
+	if len(resources) < 1 {
+		log.Printf("[%s] no instance found", region)
+		return nil, nil
+	}
+
+	events := []lib.Event{}
+	for _, r := range resources {
+		id := r.ID
+		tags := r.Tags
+		driver := lib.DriverOf(drivers, r.Type)
+
+		// suspend time is in the instance timezone (UTC if not defined)
+		location, err := lib.LoadLocation(tags[conf.ScheduleTagTZ])
+		if err != nil {
+			log.Printf("[%s/%s] unknown timezone %s, using UTC: %s", region, id, tags[conf.ScheduleTagTZ], err)
 		}
 
 		// parse suspend time
-		if _, ok := scheduleTagSuspendLayouts[len(tags[conf.ScheduleTagSuspend])]; !ok {
-			log.Printf("[%s] layout doesn't match any supported one %s", *instance.InstanceId, tags[conf.ScheduleTagSuspend])
-			continue
-		}
-		suspendTime, err := time.Parse(scheduleTagSuspendLayouts[len(tags[conf.ScheduleTagSuspend])], tags[conf.ScheduleTagSuspend])
+		suspendTime, err := lib.ParseDate(tags[conf.ScheduleTagSuspend], location)
 		if err != nil {
-			log.Printf("[%s] can't parse date %s", *instance.InstanceId, tags[conf.ScheduleTagSuspend])
+			log.Printf("[%s/%s] can't parse date %s: %s", region, id, tags[conf.ScheduleTagSuspend], err)
 			continue
 		}
 
 		// check if suspend time is expired
 		if time.Now().After(suspendTime) {
-			log.Printf("[%s] suspension tag [%s] expired. unsuspending...", *instance.InstanceId, tags[conf.ScheduleTagSuspend])
+			log.Printf("[%s/%s] suspension tag [%s] expired. unsuspending...", region, id, tags[conf.ScheduleTagSuspend])
 
-			// delete suspend tag
-			err := deleteSuspendTag(ctx, client, conf.ScheduleTagSuspend, *instance.InstanceId)
+			// delete suspend tags
+			err := driver.DeleteTags(ctx, r, conf.ScheduleTagSuspend, conf.ScheduleTagSuspendMode)
 			if err != nil {
-				log.Printf("[%s] unable to remove tag %s. Error: %s", *instance.InstanceId, conf.ScheduleTagSuspend, err)
+				log.Printf("[%s/%s] unable to remove tag %s. Error: %s", region, id, conf.ScheduleTagSuspend, err)
 				continue
 			}
 
 			// uncomment scheduleTag
-			err = createTags(ctx, client, *instance.InstanceId, []types.Tag{
-				{
-					Key:   aws.String(conf.ScheduleTag),
-					Value: aws.String(strings.Replace(tags[conf.ScheduleTag], "#", "", -1)),
-				},
+			err = driver.CreateTags(ctx, r, map[string]string{
+				conf.ScheduleTag: lib.EnableSchedule(tags[conf.ScheduleTag]),
 			})
 			if err != nil {
-				log.Printf("[%s] unable to uncomment tag %s. Error: %s", *instance.InstanceId, conf.ScheduleTag, err)
+				log.Printf("[%s/%s] unable to uncomment tag %s. Error: %s", region, id, conf.ScheduleTag, err)
+				continue
 			}
-		}
-	}
-
-	log.Printf("done and dusted")
-	return nil
-}
-
-func deleteSuspendTag(ctx context.Context, client *ec2.Client, tag, instanceID string) error {
-	_, err := client.DeleteTags(ctx, &ec2.DeleteTagsInput{
-		Resources: []string{instanceID},
-		Tags: []types.Tag{
-			{
-				Key: aws.String(tag),
-			},
-		},
-	})
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
 
-func createTags(ctx context.Context, client *ec2.Client, instanceID string, tags []types.Tag) error {
-	_, err := client.CreateTags(ctx, &ec2.CreateTagsInput{
-		Resources: []string{instanceID},
-		Tags:      tags,
-	})
-	if err != nil {
-		return err
+			events = append(events, lib.NewEvent(lib.EventScheduleUnsuspended, lib.EventDetail{
+				Type:         r.Type,
+				InstanceID:   id,
+				InstanceName: r.Name,
+				Region:       region,
+				Schedule:     lib.EnableSchedule(tags[conf.ScheduleTag]),
+				Reason:       fmt.Sprintf("suspension expired on %s", tags[conf.ScheduleTagSuspend]),
+			}))
+		}
 	}
 
-	return nil
+	return events, nil
 }
@@ -3,37 +3,37 @@ package main
 // Suspend
 // event:
 // { "instanceId": "i-00e92a5a9cb7eeb4d", "unsuspendDatetime": "20171117" }
+// { "instanceId": "i-00e92a5a9cb7eeb4d", "unsuspendDatetime": "3h" }
+// { "instanceId": "i-00e92a5a9cb7eeb4d", "unsuspendDatetime": "until next monday" }
+// { "instanceId": "i-00e92a5a9cb7eeb4d", "unsuspendDatetime": "eod", "mode": "running" }
+// { "type": "autoScalingGroup", "instanceId": "web", "unsuspendDatetime": "3h" }
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"time"
 
 	"github.com/aws/aws-lambda-go/lambda"
-	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/service/ec2"
-	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
 	"github.com/caarlos0/env/v6"
+	"github.com/dwtechnologies/ec2scheduler/source/lib"
 )
 
 type inputEvent struct {
+	// instance (default), autoScalingGroup, dbInstance, dbCluster or ecsService (cluster/service)
+	Type              string `json:"type"`
 	InstanceID        string `json:"instanceId"`
 	UnsuspendDatetime string `json:"unsuspendDatetime"`
+	// freeze (default), running or stopped, see lib.SuspendModes
+	Mode string `json:"mode"`
 }
 
 type lambdaConfig struct {
-	ScheduleTag        string `env:"SCHEDULE_TAG" envDefault:"Schedule"`
-	ScheduleTagSuspend string `env:"SCHEDULE_TAG_SUSPEND" envDefault:"ScheduleSuspendUntil"`
-}
-
-var scheduleTagSuspendLayouts = map[int]string{
-	4:  "2006",
-	6:  "200601",
-	8:  "20060102",
-	11: "20060102T15",
-	14: "20060102T15:04",
+	lib.TagConfig
+	lib.EventConfig
 }
 
 func main() {
@@ -48,68 +48,93 @@ func handler(ctx context.Context, event inputEvent) (string, error) {
 		return "", err
 	}
 
-	// parse suspend time
-	if _, ok := scheduleTagSuspendLayouts[len(event.UnsuspendDatetime)]; !ok {
-		log.Printf("[%s] layout doesn't match any supported one %s", event.InstanceID, event.UnsuspendDatetime)
+	// check suspend time syntax, absolute or relative (3h, end of day, next monday)
+	_, err := lib.ParseSuspendUntil(event.UnsuspendDatetime, time.Now())
+	if err != nil {
+		log.Printf("[%s] can't parse date %s: %s", event.InstanceID, event.UnsuspendDatetime, err)
 		return fmt.Sprintf("unable to parse date: %s", event.UnsuspendDatetime), nil
 	}
-	_, err := time.Parse(scheduleTagSuspendLayouts[len(event.UnsuspendDatetime)], event.UnsuspendDatetime)
+	mode, err := lib.ParseSuspendMode(event.Mode)
 	if err != nil {
-		log.Printf("[%s] can't parse date %s", event.InstanceID, event.UnsuspendDatetime)
-		return fmt.Sprintf("unable to parse date: %s", event.UnsuspendDatetime), nil
+		log.Printf("[%s] %s", event.InstanceID, err)
+		return fmt.Sprintf("unable to parse mode: %s", event.Mode), nil
 	}
 
 	cfg, err := config.LoadDefaultConfig(ctx)
 	if err != nil {
 		return "", err
 	}
-	client := ec2.NewFromConfig(cfg)
+	if event.Type == "" {
+		event.Type = lib.ResourceTypeInstance
+	}
+	driver := lib.DriverOf(lib.NewDrivers(cfg, cfg.Region, conf.TagConfig), event.Type)
+	if driver == nil {
+		log.Printf("[%s] unknown type %s", event.InstanceID, event.Type)
+		return fmt.Sprintf("unknown type: %s", event.Type), nil
+	}
 
-	resp, err := client.DescribeInstances(ctx, &ec2.DescribeInstancesInput{
-		InstanceIds: []string{event.InstanceID},
-	})
+	resource, err := driver.Get(ctx, event.Type, event.InstanceID)
+	if errors.Is(err, lib.ErrNotFound) {
+		log.Printf("[%s] no %s found", event.InstanceID, event.Type)
+		return fmt.Sprintf("no %s found with ID %s", event.Type, event.InstanceID), nil
+	}
 	if err != nil {
 		return "", err
 	}
 
-	if len(resp.Reservations) < 1 {
-		log.Printf("[%s] no instance found", event.InstanceID)
-		return fmt.Sprintf("no instance found with ID %s", event.InstanceID), nil
-	}
-
-	for _, tag := range resp.Reservations[0].Instances[0].Tags {
-		if *tag.Key == conf.ScheduleTag {
-			err = createTags(ctx, client, event.InstanceID, []types.Tag{
-				{
-					Key:   aws.String(conf.ScheduleTagSuspend),
-					Value: aws.String(event.UnsuspendDatetime),
-				},
-				{
-					Key:   aws.String(conf.ScheduleTag),
-					Value: aws.String(fmt.Sprintf("#%s", *tag.Value)),
-				},
-			})
-			if err != nil {
-				return "", err
-			}
-
-			log.Printf("[%s] scheduler suspended until %s", event.InstanceID, event.UnsuspendDatetime)
-			return fmt.Sprintf("instance %s scheduler suspended until %s", event.InstanceID, event.UnsuspendDatetime), nil
-		}
+	// suspend time is in the instance timezone (UTC if not defined)
+	location, err := lib.LoadLocation(resource.Tags[conf.ScheduleTagTZ])
+	if err != nil {
+		log.Printf("[%s] unknown timezone, using UTC: %s", event.InstanceID, err)
+	}
+	// relative suspend times are resolved now and stored in their absolute form
+	unsuspendTime, err := lib.ParseSuspendUntil(event.UnsuspendDatetime, time.Now().In(location))
+	if err != nil {
+		log.Printf("[%s] can't parse date %s", event.InstanceID, event.UnsuspendDatetime)
+		return fmt.Sprintf("unable to parse date: %s", event.UnsuspendDatetime), nil
 	}
 
-	log.Printf("[%s] unable to find %s tag", event.InstanceID, conf.ScheduleTag)
-	return fmt.Sprintf("unable to find %s tag for instance %s", conf.ScheduleTag, event.InstanceID), nil
-}
+	schedule, ok := resource.Tags[conf.ScheduleTag]
+	if !ok {
+		log.Printf("[%s] unable to find %s tag", event.InstanceID, conf.ScheduleTag)
+		return fmt.Sprintf("unable to find %s tag for %s %s", conf.ScheduleTag, event.Type, event.InstanceID), nil
+	}
+
+	suspendTags := map[string]string{
+		conf.ScheduleTagSuspend: unsuspendTime.Format(lib.SuspendLayout),
+		conf.ScheduleTag:        lib.DisableSchedule(schedule),
+	}
+	// the engine enforces running/stopped, freeze leaves the instance as it is
+	if mode != lib.SuspendModeFreeze {
+		suspendTags[conf.ScheduleTagSuspendMode] = mode
+	}
+
+	err = driver.CreateTags(ctx, resource, suspendTags)
+	if err != nil {
+		return "", err
+	}
+
+	// a previous suspend mode doesn't apply anymore
+	if mode == lib.SuspendModeFreeze {
+		if err := driver.DeleteTags(ctx, resource, conf.ScheduleTagSuspendMode); err != nil {
+			log.Printf("[%s] unable to remove tag %s: %s", event.InstanceID, conf.ScheduleTagSuspendMode, err)
+		}
+	}
 
-func createTags(ctx context.Context, client *ec2.Client, instanceID string, tags []types.Tag) error {
-	_, err := client.CreateTags(ctx, &ec2.CreateTagsInput{
-		Resources: []string{instanceID},
-		Tags:      tags,
-	})
+	log.Printf("[%s] scheduler suspended until %s (%s)", event.InstanceID, unsuspendTime, mode)
+
+	publisher := lib.NewEventPublisher(eventbridge.NewFromConfig(cfg), conf.EventBus)
+	err = publisher.Put(ctx, lib.NewEvent(lib.EventScheduleSuspended, lib.EventDetail{
+		Type:         event.Type,
+		InstanceID:   event.InstanceID,
+		InstanceName: resource.Name,
+		Schedule:     schedule,
+		SuspendUntil: unsuspendTime.Format(lib.SuspendLayout),
+		SuspendMode:  mode,
+	}))
 	if err != nil {
-		return err
+		log.Printf("[%s] unable to put event on %s: %s", event.InstanceID, conf.EventBus, err)
 	}
 
-	return nil
+	return fmt.Sprintf("%s %s scheduler suspended until %s (%s), %s", event.Type, event.InstanceID, unsuspendTime.Format(lib.SuspendLayout), location, mode), nil
 }
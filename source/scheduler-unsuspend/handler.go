@@ -2,24 +2,25 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
-	"strings"
 
 	"github.com/aws/aws-lambda-go/lambda"
-	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/service/ec2"
-	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
 	"github.com/caarlos0/env/v6"
+	"github.com/dwtechnologies/ec2scheduler/source/lib"
 )
 
 type inputEvent struct {
+	// instance (default), autoScalingGroup, dbInstance, dbCluster or ecsService (cluster/service)
+	Type       string `json:"type"`
 	InstanceID string `json:"instanceId"`
 }
 type lambdaConfig struct {
-	ScheduleTag        string `env:"SCHEDULE_TAG" envDefault:"Schedule"`
-	ScheduleTagSuspend string `env:"SCHEDULE_TAG_SUSPEND" envDefault:"ScheduleSuspendUntil"`
+	lib.TagConfig
+	lib.EventConfig
 }
 
 func main() {
@@ -38,73 +39,57 @@ func handler(ctx context.Context, event inputEvent) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	client := ec2.NewFromConfig(cfg)
 
-	resp, err := client.DescribeInstances(ctx, &ec2.DescribeInstancesInput{
-		InstanceIds: []string{event.InstanceID},
-	})
-	if err != nil {
-		return "", err
+	if event.Type == "" {
+		event.Type = lib.ResourceTypeInstance
+	}
+	driver := lib.DriverOf(lib.NewDrivers(cfg, cfg.Region, conf.TagConfig), event.Type)
+	if driver == nil {
+		log.Printf("unknown type %s", event.Type)
+		return fmt.Sprintf("unknown type: %s", event.Type), nil
 	}
 
-	if len(resp.Reservations) < 1 {
-		log.Printf("no instance found %s", event.InstanceID)
+	resource, err := driver.Get(ctx, event.Type, event.InstanceID)
+	if errors.Is(err, lib.ErrNotFound) {
+		log.Printf("no %s found %s", event.Type, event.InstanceID)
 		return "", nil
 	}
+	if err != nil {
+		return "", err
+	}
 
-	for _, tag := range resp.Reservations[0].Instances[0].Tags {
-		// remove suspend tag (scheduleTagSuspend)
-		if *tag.Key == conf.ScheduleTagSuspend {
-			err := deleteSuspendTag(ctx, client, conf.ScheduleTagSuspend, event.InstanceID)
-			if err != nil {
-				log.Printf("unable to remove tag %s", conf.ScheduleTagSuspend)
-				return fmt.Sprintf("unable to remove tag %s", conf.ScheduleTagSuspend), err
-			}
-		}
-
-		// uncomment scheduleTag
-		if *tag.Key == conf.ScheduleTag {
-			err := createTags(ctx, client, event.InstanceID, []types.Tag{
-				{
-					Key:   aws.String(conf.ScheduleTag),
-					Value: aws.String(strings.Replace(*tag.Value, "#", "", -1)),
-				},
-			})
-			if err != nil {
-				log.Printf("unable to uncomment tag %s", conf.ScheduleTag)
-				return fmt.Sprintf("unable to uncomment tag %s", conf.ScheduleTag), err
-			}
+	// remove suspend tags (scheduleTagSuspend, scheduleTagSuspendMode)
+	if _, ok := resource.Tags[conf.ScheduleTagSuspend]; ok {
+		err := driver.DeleteTags(ctx, resource, conf.ScheduleTagSuspend, conf.ScheduleTagSuspendMode)
+		if err != nil {
+			log.Printf("unable to remove tag %s", conf.ScheduleTagSuspend)
+			return fmt.Sprintf("unable to remove tag %s", conf.ScheduleTagSuspend), err
 		}
 	}
 
-	log.Printf("instance %s scheduler unsuspended", event.InstanceID)
-	return fmt.Sprintf("instance %s scheduler unsuspended", event.InstanceID), nil
-}
-
-func deleteSuspendTag(ctx context.Context, client *ec2.Client, tag, instanceID string) error {
-	_, err := client.DeleteTags(ctx, &ec2.DeleteTagsInput{
-		Resources: []string{instanceID},
-		Tags: []types.Tag{
-			{
-				Key: aws.String(tag),
-			},
-		},
-	})
-	if err != nil {
-		return err
+	// uncomment scheduleTag
+	if schedule, ok := resource.Tags[conf.ScheduleTag]; ok {
+		err := driver.CreateTags(ctx, resource, map[string]string{
+			conf.ScheduleTag: lib.EnableSchedule(schedule),
+		})
+		if err != nil {
+			log.Printf("unable to uncomment tag %s", conf.ScheduleTag)
+			return fmt.Sprintf("unable to uncomment tag %s", conf.ScheduleTag), err
+		}
 	}
 
-	return nil
-}
+	log.Printf("%s %s scheduler unsuspended", event.Type, event.InstanceID)
 
-func createTags(ctx context.Context, client *ec2.Client, instanceID string, tags []types.Tag) error {
-	_, err := client.CreateTags(ctx, &ec2.CreateTagsInput{
-		Resources: []string{instanceID},
-		Tags:      tags,
-	})
+	publisher := lib.NewEventPublisher(eventbridge.NewFromConfig(cfg), conf.EventBus)
+	err = publisher.Put(ctx, lib.NewEvent(lib.EventScheduleUnsuspended, lib.EventDetail{
+		Type:         event.Type,
+		InstanceID:   event.InstanceID,
+		InstanceName: resource.Name,
+		Schedule:     lib.EnableSchedule(resource.Tags[conf.ScheduleTag]),
+	}))
 	if err != nil {
-		return err
+		log.Printf("unable to put event on %s: %s", conf.EventBus, err)
 	}
 
-	return nil
+	return fmt.Sprintf("%s %s scheduler unsuspended", event.Type, event.InstanceID), nil
 }
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dwtechnologies/ec2scheduler/source/lib"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShouldRunCron(t *testing.T) {
+	start, stop, _ := lib.ParseCronSchedule("start=0 7 * * 1-5;stop=30 18 * * 1-5")
+	stockholm, _ := time.LoadLocation("Europe/Stockholm")
+
+	tests := []struct {
+		name string
+		sch  *scheduler
+		now  time.Time
+		want lib.State
+	}{
+		{
+			name: "start fired in the last interval",
+			sch: &scheduler{
+				instanceID:    instanceID,
+				instanceState: lib.StateStopped,
+				cronStart:     start,
+				cronStop:      stop,
+				interval:      5 * time.Minute,
+			},
+			now:  time.Date(2021, 01, 04, 7, 02, 13, 00, time.UTC), // Monday
+			want: lib.StateRunning,
+		},
+		{
+			name: "start fired before the last interval",
+			sch: &scheduler{
+				instanceID:    instanceID,
+				instanceState: lib.StateStopped,
+				cronStart:     start,
+				cronStop:      stop,
+				interval:      5 * time.Minute,
+			},
+			now:  time.Date(2021, 01, 04, 7, 07, 13, 00, time.UTC), // Monday
+			want: lib.StateStopped,
+		},
+		{
+			name: "stop fired in the last interval",
+			sch: &scheduler{
+				instanceID:    instanceID,
+				instanceState: lib.StateRunning,
+				cronStart:     start,
+				cronStop:      stop,
+				interval:      5 * time.Minute,
+			},
+			now:  time.Date(2021, 01, 04, 18, 30, 00, 00, time.UTC), // Monday
+			want: lib.StateStopped,
+		},
+		{
+			name: "nothing fired - keep state",
+			sch: &scheduler{
+				instanceID:    instanceID,
+				instanceState: lib.StateRunning,
+				cronStart:     start,
+				cronStop:      stop,
+				interval:      5 * time.Minute,
+			},
+			now:  time.Date(2021, 01, 04, 20, 00, 00, 00, time.UTC), // Monday
+			want: lib.StateRunning,
+		},
+		{
+			name: "start fired in the instance timezone",
+			sch: &scheduler{
+				instanceID:    instanceID,
+				instanceState: lib.StateStopped,
+				location:      stockholm,
+				cronStart:     start,
+				interval:      5 * time.Minute,
+			},
+			now:  time.Date(2021, 06, 14, 5, 03, 00, 00, time.UTC), // Monday 07:03 CEST
+			want: lib.StateRunning,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, _ := test.sch.shouldRun(test.sch.localTime(test.now))
+
+			assert.Equal(t, test.want, got)
+		})
+	}
+}
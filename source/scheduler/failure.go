@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/smithy-go"
+	"github.com/dwtechnologies/ec2scheduler/source/lib"
+)
+
+// failure classes, by AWS error code
+const (
+	failureCapacity    = "capacity"
+	failureLimit       = "limit"
+	failureKMS         = "kms"
+	failureUnsupported = "unsupported"
+	failureState       = "state"
+	failurePermission  = "permission"
+	failureThrottling  = "throttling"
+	failureUnknown     = "unknown"
+)
+
+// failure classes of the known AWS error codes, KMS errors are matched on their prefix
+var failureClasses = map[string]string{
+	"InsufficientInstanceCapacity":   failureCapacity,
+	"InsufficientHostCapacity":       failureCapacity,
+	"InsufficientCapacity":           failureCapacity,
+	"InsufficientDBInstanceCapacity": failureCapacity,
+	"InstanceLimitExceeded":          failureLimit,
+	"VcpuLimitExceeded":              failureLimit,
+	"UnsupportedOperation":           failureUnsupported,
+	"UnsupportedInstanceAttribute":   failureUnsupported,
+	"IncorrectInstanceState":         failureState,
+	"IncorrectState":                 failureState,
+	"InvalidDBInstanceState":         failureState,
+	"InvalidDBClusterStateFault":     failureState,
+	"UnauthorizedOperation":          failurePermission,
+	"AccessDenied":                   failurePermission,
+	"RequestLimitExceeded":           failureThrottling,
+	"Throttling":                     failureThrottling,
+}
+
+// failed start/stop of an instance
+type failure struct {
+	Account       string    `json:"account,omitempty"`
+	Region        string    `json:"region"`
+	InstanceID    string    `json:"instanceId"`
+	InstanceName  string    `json:"instanceName,omitempty"`
+	ExpectedState lib.State `json:"expectedState"`
+	ErrorCode     string    `json:"errorCode,omitempty"`
+	ErrorClass    string    `json:"errorClass"`
+	Error         string    `json:"error"`
+}
+
+func (s *scheduler) failure(err error) failure {
+	code := errorCode(err)
+	return failure{
+		Account:       s.accountID,
+		Region:        s.region,
+		InstanceID:    s.instanceID,
+		InstanceName:  s.instanceName,
+		ExpectedState: s.expectedState,
+		ErrorCode:     code,
+		ErrorClass:    classifyError(code),
+		Error:         err.Error(),
+	}
+}
+
+// AWS error code of err, empty if it isn't an API error
+func errorCode(err error) string {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.ErrorCode()
+	}
+
+	return ""
+}
+
+func classifyError(code string) string {
+	if class, ok := failureClasses[code]; ok {
+		return class
+	}
+	if strings.HasPrefix(code, "KMS") || strings.Contains(code, "KMSKey") {
+		return failureKMS
+	}
+
+	return failureUnknown
+}
+
+// state-change-failed notification of the failure
+func (s *scheduler) failureNotification(conf *lambdaConfig, f failure, now time.Time) notification {
+	n := s.newNotification(conf, eventStateChangeFailed, f.ExpectedState, s.reason, now)
+	n.Subject = fmt.Sprintf("%s (%s) unable to change state to %s: %s", s.instanceID, s.instanceName, f.ExpectedState, f.ErrorClass)
+	n.Error = f.Error
+	n.ErrorCode = f.ErrorCode
+	n.ErrorClass = f.ErrorClass
+
+	return n
+}
+
+// CloudWatch embedded metric format record of the run, in the ec2scheduler namespace
+// the Lambda runtime turns the log line into the Started, Stopped and Failed metrics
+func metricsRecord(result *handlerResult, conf *lambdaConfig, now time.Time) (string, error) {
+	dimensions := [][]string{{}}
+	record := map[string]interface{}{
+		"_aws": map[string]interface{}{
+			"Timestamp": now.UnixNano() / int64(time.Millisecond),
+			"CloudWatchMetrics": []map[string]interface{}{
+				{
+					"Namespace":  "ec2scheduler",
+					"Dimensions": dimensions,
+					"Metrics": []map[string]string{
+						{"Name": "Started", "Unit": "Count"},
+						{"Name": "Stopped", "Unit": "Count"},
+						{"Name": "Failed", "Unit": "Count"},
+					},
+				},
+			},
+		},
+		"Started": result.Started,
+		"Stopped": result.Stopped,
+		"Failed":  len(result.Failures),
+	}
+	if conf.Environment != "" {
+		dimensions[0] = []string{"Environment"}
+		record["Environment"] = conf.Environment
+	}
+
+	b, err := json.Marshal(record)
+	if err != nil {
+		return "", err
+	}
+
+	return string(b), nil
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aws/smithy-go"
+	"github.com/dwtechnologies/ec2scheduler/source/lib"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClassifyError(t *testing.T) {
+	tests := map[string]string{
+		"InsufficientInstanceCapacity": failureCapacity,
+		"VcpuLimitExceeded":            failureLimit,
+		"KMS.DisabledException":        failureKMS,
+		"InvalidKMSKey.InvalidState":   failureKMS,
+		"UnsupportedOperation":         failureUnsupported,
+		"IncorrectInstanceState":       failureState,
+		"UnauthorizedOperation":        failurePermission,
+		"RequestLimitExceeded":         failureThrottling,
+		"InternalError":                failureUnknown,
+		"":                             failureUnknown,
+	}
+
+	for code, want := range tests {
+		assert.Equal(t, want, classifyError(code), code)
+	}
+}
+
+func TestSchedulerFailure(t *testing.T) {
+	sch := &scheduler{
+		instanceID:    instanceID,
+		instanceName:  "web-1",
+		expectedState: lib.StateRunning,
+	}
+
+	// API errors are wrapped by the SDK
+	err := fmt.Errorf("operation error EC2: StartInstances, %w", &smithy.GenericAPIError{
+		Code:    "InsufficientInstanceCapacity",
+		Message: "We currently do not have sufficient capacity",
+	})
+	assert.Equal(t, failure{
+		InstanceID:    instanceID,
+		InstanceName:  "web-1",
+		ExpectedState: lib.StateRunning,
+		ErrorCode:     "InsufficientInstanceCapacity",
+		ErrorClass:    failureCapacity,
+		Error:         err.Error(),
+	}, sch.failure(err))
+
+	f := sch.failure(fmt.Errorf("no state change to running returned"))
+	assert.Equal(t, "", f.ErrorCode)
+	assert.Equal(t, failureUnknown, f.ErrorClass)
+
+	n := sch.failureNotification(&lambdaConfig{}, sch.failure(err), time.Date(2021, 01, 11, 7, 02, 00, 00, time.UTC))
+	assert.Equal(t, eventStateChangeFailed, n.Event)
+	assert.Equal(t, "i-07d023c826d243165 (web-1) unable to change state to running: capacity", n.Subject)
+	assert.Equal(t, "capacity", *n.attributes()["errorClass"].StringValue)
+}
+
+func TestMetricsRecord(t *testing.T) {
+	result := &handlerResult{
+		Started:  2,
+		Stopped:  1,
+		Failures: []failure{{InstanceID: instanceID}},
+	}
+	now := time.Date(2021, 01, 11, 7, 02, 00, 00, time.UTC)
+
+	got, err := metricsRecord(result, &lambdaConfig{Environment: "prod"}, now)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{
+		"_aws": {
+			"Timestamp": 1610348520000,
+			"CloudWatchMetrics": [
+				{
+					"Namespace": "ec2scheduler",
+					"Dimensions": [["Environment"]],
+					"Metrics": [
+						{"Name": "Started", "Unit": "Count"},
+						{"Name": "Stopped", "Unit": "Count"},
+						{"Name": "Failed", "Unit": "Count"}
+					]
+				}
+			]
+		},
+		"Environment": "prod",
+		"Started": 2,
+		"Stopped": 1,
+		"Failed": 1
+	}`, got)
+
+	// no environment, no dimension
+	got, err = metricsRecord(result, &lambdaConfig{}, now)
+	assert.NoError(t, err)
+	record := map[string]interface{}{}
+	assert.NoError(t, json.Unmarshal([]byte(got), &record))
+	assert.NotContains(t, record, "Environment")
+}
@@ -2,212 +2,782 @@ package main
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"net/http"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/aws/aws-lambda-go/lambda"
-	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/ec2"
-	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	"github.com/aws/aws-sdk-go-v2/service/organizations"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
 	"github.com/caarlos0/env/v6"
+	"github.com/dwtechnologies/ec2scheduler/source/lib"
 )
 
 type scheduler struct {
 	instanceID    string
 	instanceName  string
-	instanceState types.InstanceStateName
+	instanceState lib.State
+	accountID     string
+	region        string
+
+	// scheduled resource and its driver, starting/stopping it and writing its tags
+	resource     lib.Resource
+	driver       lib.Driver
+	resourceType string
 
 	suspended bool
-	startTime time.Time
-	stopTime  time.Time
-	weekdays  []time.Weekday
+	// state enforced while suspended, lib.SuspendMode*
+	suspendMode string
+	// end of the suspension (scheduleTagSuspend), zero if disabled rather than suspended
+	suspendUntil time.Time
+	schedule     string
+	// scheduleTag parsing error, the schedule is not applied
+	scheduleErr error
+	windows     []lib.TimeWindow
+	weekdays    []time.Weekday
+	location    *time.Location
+
+	// holidays, the instance doesn't run on these dates
+	calendar *lib.Calendar
+
+	// the schedule applies from/until these dates
+	activeFrom  time.Time
+	activeUntil time.Time
+
+	// cron schedule, alternative to windows
+	cronStart *lib.CronSchedule
+	cronStop  *lib.CronSchedule
+	// time between engine runs, a cron start/stop is applied if it fired within it
+	interval time.Duration
+
+	// scheduleTagSNS: SNS topics and webhooks, see notifiers
+	notifyTargets []string
+
+	// notice given before a stop, 0 to not warn
+	warn time.Duration
+	// stop already warned about (scheduleTagWarned), lib.SuspendLayout in the instance timezone
+	warnedStop string
+
+	// Auto Scaling group of the instance, scheduled with the group rather than on its own
+	autoScalingGroup string
+
+	// when the scheduler stopped the RDS database (scheduleTagStopped)
+	stoppedAt time.Time
+
+	// state the instance should be in and why, shouldRun result
+	expectedState lib.State
+	reason        string
+}
 
-	snsTopicArn string
+// result of fixing an instance state
+type stateChange struct {
+	// new state, empty if nothing changed
+	state lib.State
+	err   error
 }
 
 type lambdaConfig struct {
-	ScheduleTag    string `env:"SCHEDULE_TAG" envDefault:"Schedule"`
-	ScheduleTagDay string `env:"SCHEDULE_TAG_DAY" envDefault:"ScheduleDay"`
-	ScheduleTagSNS string `env:"SCHEDULE_TAG_SNS" envDefault:"ScheduleSNS"`
+	lib.TagConfig
+	lib.EventConfig
+	lib.RegionConfig
+	lib.AccountConfig
+	lib.CalendarConfig
+
+	// comment out scheduleTag once scheduleTagUntil is expired and the instance stopped
+	ScheduleUntilDisable bool `env:"SCHEDULE_UNTIL_DISABLE" envDefault:"false"`
+
+	// unsuspend instances once scheduleTagSuspend is expired, false if ec2scheduler-suspend-mon does it
+	UnsuspendExpired bool `env:"UNSUSPEND_EXPIRED" envDefault:"true"`
+
+	// how often the engine runs (rate of the Timer event)
+	ScheduleInterval time.Duration `env:"SCHEDULE_INTERVAL" envDefault:"5m"`
+
+	// default notice given before a stop, overridden by scheduleTagWarn, 0 to not warn
+	ScheduleWarn time.Duration `env:"SCHEDULE_WARN" envDefault:"0s"`
+
+	// deployment environment (prod, dev), sent along with the notifications
+	Environment string `env:"ENVIRONMENT"`
+
+	// notification targets (as scheduleTagSNS) of the failed starts/stops of every instance
+	OpsTopic string `env:"OPS_TOPIC"`
+
+	// HMAC-SHA256 key signing the generic webhook notifications
+	WebhookSecret string `env:"WEBHOOK_SECRET"`
+
+	// evaluate the schedules and return the plan, without starting/stopping instances
+	DryRun bool `env:"DRY_RUN" envDefault:"false"`
+}
+
+// invocation event, the Timer event has none of these fields
+type inputEvent struct {
+	DryRun bool `json:"dryRun"`
+}
+
+// what the engine did, or would do in dry-run
+type handlerResult struct {
+	DryRun bool        `json:"dryRun"`
+	Plan   []planEntry `json:"plan"`
+
+	// instances started and stopped, failed starts/stops
+	Started  int       `json:"started"`
+	Stopped  int       `json:"stopped"`
+	Failures []failure `json:"failures"`
+
+	// regions (account/region cross-account) and accounts that couldn't be scheduled, and why
+	RegionErrors  map[string]string `json:"regionErrors,omitempty"`
+	AccountErrors map[string]string `json:"accountErrors,omitempty"`
+
+	// started, stopped and failed by account, cross-account only
+	Accounts map[string]accountSummary `json:"accounts,omitempty"`
 }
 
-type ec2ClientAPI interface {
-	// DescribeInstances(ctx context.Context, params *ec2.DescribeInstancesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeInstancesOutput, error)
-	// CreateTags(ctx context.Context, params *ec2.CreateTagsInput, optFns ...func(*ec2.Options)) (*ec2.CreateTagsOutput, error)
+type accountSummary struct {
+	Started int `json:"started"`
+	Stopped int `json:"stopped"`
+	Failed  int `json:"failed"`
+}
 
-	StartInstances(ctx context.Context, params *ec2.StartInstancesInput, optFns ...func(*ec2.Options)) (*ec2.StartInstancesOutput, error)
-	StopInstances(ctx context.Context, params *ec2.StopInstancesInput, optFns ...func(*ec2.Options)) (*ec2.StopInstancesOutput, error)
+func newHandlerResult(dryRun bool) *handlerResult {
+	return &handlerResult{
+		DryRun:        dryRun,
+		Plan:          []planEntry{},
+		Failures:      []failure{},
+		RegionErrors:  map[string]string{},
+		AccountErrors: map[string]string{},
+		Accounts:      map[string]accountSummary{},
+	}
+}
+
+// add the result of an account, empty for the Lambda account
+func (r *handlerResult) mergeAccount(account string, other *handlerResult) {
+	r.merge(other)
+	if account == "" {
+		for region, err := range other.RegionErrors {
+			r.RegionErrors[region] = err
+		}
+		return
+	}
+
+	for region, err := range other.RegionErrors {
+		r.RegionErrors[account+"/"+region] = err
+	}
+	r.Accounts[account] = accountSummary{Started: other.Started, Stopped: other.Stopped, Failed: len(other.Failures)}
+}
+
+// add the result of a region
+func (r *handlerResult) merge(region *handlerResult) {
+	r.Plan = append(r.Plan, region.Plan...)
+	r.Started += region.Started
+	r.Stopped += region.Stopped
+	r.Failures = append(r.Failures, region.Failures...)
+}
+
+type planEntry struct {
+	Type          string    `json:"type,omitempty"`
+	Account       string    `json:"account,omitempty"`
+	Region        string    `json:"region"`
+	InstanceID    string    `json:"instanceId"`
+	InstanceName  string    `json:"instanceName,omitempty"`
+	CurrentState  lib.State `json:"currentState"`
+	ExpectedState lib.State `json:"expectedState"`
+	Reason        string    `json:"reason"`
+}
+
+type snsClientAPI interface {
+	Publish(ctx context.Context, params *sns.PublishInput, optFns ...func(*sns.Options)) (*sns.PublishOutput, error)
 }
 
 func main() {
 	lambda.Start(handler)
 }
 
-func handler(ctx context.Context) error {
+func handler(ctx context.Context, event inputEvent) (*handlerResult, error) {
 	// parse env variables
 	conf := &lambdaConfig{}
 	if err := env.Parse(conf); err != nil {
 		log.Printf("%s", err)
-		return err
+		return nil, err
 	}
+	result := newHandlerResult(conf.DryRun || event.DryRun)
 
 	cfg, err := config.LoadDefaultConfig(ctx)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	notifiers := &notifiers{
+		sns:           newRegionalSNSClient(cfg),
+		http:          &http.Client{Timeout: 10 * time.Second},
+		webhookSecret: conf.WebhookSecret,
 	}
-	client := ec2.NewFromConfig(cfg)
-
-	resp, err := client.DescribeInstances(ctx, &ec2.DescribeInstancesInput{
-		Filters: []types.Filter{
-			{
-				Name: aws.String("instance-state-name"),
-				Values: []string{
-					"running",
-					"stopped",
-				},
-			},
-			{
-				Name: aws.String("tag-key"),
-				Values: []string{
-					conf.ScheduleTag,
-				},
-			},
-		},
+	publisher := lib.NewEventPublisher(eventbridge.NewFromConfig(cfg), conf.EventBus)
+	calendars := lib.NewCalendarStore(s3.NewFromConfig(cfg), ssm.NewFromConfig(cfg), conf.CalendarConfig)
+
+	accounts, err := lib.ParseAccounts(ctx, conf.AccountConfig, ssm.NewFromConfig(cfg), organizations.NewFromConfig(cfg))
+	if err != nil {
+		return nil, err
+	}
+	stsClient := sts.NewFromConfig(cfg)
+
+	// schedule every account concurrently, through its role, a failing account doesn't affect the others
+	// events are put on the EventBridge bus once done
+	now := time.Now()
+	var mu sync.Mutex
+	events := []lib.Event{}
+	errs := lib.ForEachAccount(ctx, accounts, func(ctx context.Context, account lib.Account) error {
+		accountCfg := lib.AccountAWSConfig(cfg, stsClient, account)
+
+		// enabled regions differ from an account to another
+		regions, err := lib.ParseRegions(ctx, ec2.NewFromConfig(accountCfg), conf.Regions, cfg.Region)
+		if err != nil {
+			return err
+		}
+
+		drivers := func(region string) []lib.Driver {
+			return lib.NewDrivers(accountCfg, region, conf.TagConfig)
+		}
+		accountResult, accountEvents, err := scheduleAccount(ctx, conf, drivers, regions, calendars, notifiers, result.DryRun, now)
+		if err != nil {
+			return err
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		result.mergeAccount(account.ID, accountResult)
+		events = append(events, accountEvents...)
+		return nil
+	})
+	for account, err := range errs {
+		result.AccountErrors[account] = err.Error()
+	}
+	// nothing scheduled at all
+	if len(errs) == len(accounts) {
+		return nil, errs[accounts[0].ID]
+	}
+
+	// accounts and regions finish in any order
+	sort.SliceStable(result.Plan, func(i, j int) bool {
+		return result.Plan[i].Account+result.Plan[i].Region < result.Plan[j].Account+result.Plan[j].Region
 	})
+	sort.SliceStable(result.Failures, func(i, j int) bool {
+		return result.Failures[i].Account+result.Failures[i].Region < result.Failures[j].Account+result.Failures[j].Region
+	})
+
+	if result.DryRun {
+		return result, nil
+	}
+
+	if err := publisher.Put(ctx, events...); err != nil {
+		log.Printf("unable to put events on %s: %s", conf.EventBus, err)
+	}
+
+	// started/stopped/failed metrics, for CloudWatch alarms
+	log.Printf("%d instances started, %d stopped, %d failed", result.Started, result.Stopped, len(result.Failures))
+	metrics, err := metricsRecord(result, conf, now)
 	if err != nil {
-		return err
+		log.Printf("unable to build metrics: %s", err)
+	} else {
+		// without the log prefix, the record must be plain JSON
+		fmt.Println(metrics)
 	}
 
-	if len(resp.Reservations) < 1 {
-		log.Printf("no scheduled instance found")
+	return result, nil
+}
+
+// schedule the resources of every region of an account, drivers returns the drivers of a region
+// a failing region doesn't affect the others, the account fails if all of them do
+func scheduleAccount(ctx context.Context, conf *lambdaConfig, drivers func(region string) []lib.Driver, regions []string, calendars *lib.CalendarStore, notifiers *notifiers, dryRun bool, now time.Time) (*handlerResult, []lib.Event, error) {
+	result := newHandlerResult(dryRun)
+
+	var mu sync.Mutex
+	events := []lib.Event{}
+	errs := lib.ForEachRegion(ctx, regions, func(ctx context.Context, region string) error {
+		regionResult, regionEvents, err := scheduleRegion(ctx, conf, drivers(region), calendars, notifiers, region, dryRun, now)
+		if err != nil {
+			return err
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		result.merge(regionResult)
+		events = append(events, regionEvents...)
 		return nil
+	})
+	for region, err := range errs {
+		result.RegionErrors[region] = err.Error()
 	}
+	if len(regions) > 0 && len(errs) == len(regions) {
+		return nil, nil, errs[regions[0]]
+	}
+
+	return result, events, nil
+}
+
+// schedule the resources of every driver of region
+// return what was done (or would be, in dry-run) and the events to put on the EventBridge bus
+func scheduleRegion(ctx context.Context, conf *lambdaConfig, drivers []lib.Driver, calendars *lib.CalendarStore, notifiers *notifiers, region string, dryRun bool, now time.Time) (*handlerResult, []lib.Event, error) {
+	result := newHandlerResult(dryRun)
 
-	// outer loop Reservations (instances)
-	// inner loop instance.Tags
-	// resp.Reservations[i].Instances[0]
-	// ec2.DescribeInstancesOutput{Reservations: []ec2.RunInstancesOutput{Instances: []ec2.Instance{}}}
-	for _, reservation := range resp.Reservations {
-		instance := reservation.Instances[0]
-		s := &scheduler{
-			instanceID:    *instance.InstanceId,
-			instanceState: instance.State.Name,
+	// a driver may fail alone, the role of an account may not allow listing its resources
+	resources, errs := lib.ListResources(ctx, drivers, conf.ScheduleTag)
+	if len(drivers) > 0 && len(errs) == len(drivers) {
+		return nil, nil, errs[drivers[0]]
+	}
+	for driver, err := range errs {
+		result.RegionErrors[region+"/"+strings.Join(driver.Types(), ",")] = err.Error()
+	}
+
+	if len(resources) < 1 {
+		log.Printf("[%s] no scheduled instance found", region)
+		return result, nil, nil
+	}
+
+	// get resources expected state (running, stopped)
+	schedulers := newSchedulers(ctx, conf, calendars, drivers, resources)
+	result.Plan = plan(schedulers, now)
+
+	// dry-run, leave instances and tags untouched
+	if dryRun {
+		for _, p := range result.Plan {
+			log.Printf("[%s/%s] dry-run: %s -> %s (%s)", p.Region, p.InstanceID, p.CurrentState, p.ExpectedState, p.Reason)
 		}
+		return result, nil, nil
+	}
 
-		for _, tag := range instance.Tags {
-			// scheduler suspended
-			if *tag.Key == conf.ScheduleTag && strings.Contains(*tag.Value, "#") {
-				s.suspended = true
-				break
+	events := []lib.Event{}
+	for _, s := range schedulers {
+		if s.scheduleErr != nil {
+			event := s.event(lib.EventScheduleInvalid, now)
+			event.Detail.Error = s.scheduleErr.Error()
+			events = append(events, event)
+		}
+	}
+
+	// uncomment scheduleTag of expired suspensions, their schedule applies from this run
+	for _, s := range schedulers {
+		dateNow, _ := s.localTime(now)
+		if !s.suspended || !s.suspendExpired(dateNow) {
+			continue
+		}
+
+		if err := s.unsuspend(ctx, conf); err != nil {
+			log.Printf("[%s] unable to unsuspend scheduler: %s", s.logID(), err)
+			continue
+		}
+
+		event := s.event(lib.EventScheduleUnsuspended, now)
+		event.Detail.Reason = fmt.Sprintf("suspension expired on %s", s.suspendUntil.Format(lib.SuspendLayout))
+		events = append(events, event)
+	}
+
+	// start and stop the resources, driver by driver
+	changes := changeStates(ctx, conf, schedulers)
+
+	for _, s := range schedulers {
+		// scheduled with its group
+		if s.autoScalingGroup != "" {
+			continue
+		}
+
+		change := changes[s]
+		if change.err != nil {
+			f := s.failure(change.err)
+			result.Failures = append(result.Failures, f)
+			log.Printf("[%s] unable to change state to %s (%s): %s", s.logID(), f.ExpectedState, f.ErrorClass, f.Error)
+
+			// notify the instance targets and the ops topic
+			n := s.failureNotification(conf, f, now)
+			if err := s.notify(ctx, notifiers, n); err != nil {
+				log.Printf("[%s] unable to notify state change failure: %s", s.logID(), err)
 			}
+			if err := notifiers.send(ctx, parseNotifyTargets(conf.OpsTopic), n); err != nil {
+				log.Printf("[%s] unable to notify ops of state change failure: %s", s.logID(), err)
+			}
+			continue
+		}
+
+		switch change.state {
+		case lib.StateRunning:
+			result.Started++
+		case lib.StateStopped:
+			result.Stopped++
+		}
 
-			// instance name
-			if *tag.Key == "Name" {
-				s.instanceName = *tag.Value
+		// schedule expired and instance stopped, comment out scheduleTag
+		dateNow, _ := s.localTime(now)
+		if conf.ScheduleUntilDisable && s.expired(dateNow) && !s.suspended {
+			if err := s.disableSchedule(ctx, conf); err != nil {
+				log.Printf("[%s] unable to disable expired scheduler: %s", s.logID(), err)
+			} else {
+				event := s.event(lib.EventScheduleDisabled, now)
+				event.Detail.User = "ec2scheduler"
+				event.Detail.Reason = fmt.Sprintf("%s %s expired", conf.ScheduleTagUntil, s.activeUntil.Format("2006-01-02 15:04"))
+				events = append(events, event)
 			}
+		}
 
-			// SNS topic Arn
-			if *tag.Key == conf.ScheduleTagSNS {
-				s.snsTopicArn = *tag.Value
+		if change.state != "" {
+			events = append(events, s.stateChangeEvent(change.state, now))
+		}
+
+		// still running, warn of an upcoming stop
+		if len(s.notifyTargets) > 0 && change.state == "" && s.expectedState == lib.StateRunning {
+			if err := s.warnStop(ctx, notifiers, conf, now); err != nil {
+				log.Printf("[%s] unable to warn of upcoming stop: %s", s.logID(), err)
 			}
+		}
 
-			// get start and stop time from scheduleTag
-			if *tag.Key == conf.ScheduleTag {
-				startStopTime := strings.Split(*tag.Value, "-")
-				s.startTime, err = time.Parse("15:04", startStopTime[0])
-				if err != nil {
-					log.Printf("[%s] scheduler start time in wrong format %s: %s", s.instanceID, startStopTime[0], err)
-					break
-				}
-				s.stopTime, err = time.Parse("15:04", startStopTime[1])
-				if err != nil {
-					log.Printf("[%s] scheduler stop time in wrong format %s: %s", s.instanceID, startStopTime[1], err)
-					break
-				}
+		// notify state changes to the scheduleTagSNS targets
+		if len(s.notifyTargets) > 0 && change.state != "" {
+			err := s.publishStateChange(ctx, notifiers, conf, change.state, now)
+			if err != nil {
+				log.Printf("[%s] unable to notify state change: %s", s.logID(), err)
 			}
+		}
 
-			// get week days from scheduleTagDay
-			if *tag.Key == conf.ScheduleTagDay {
-				err := json.Unmarshal([]byte(fmt.Sprintf("[%s]", *tag.Value)), &s.weekdays)
-				if err != nil {
-					log.Printf("[%s] unable to unmarshal %s: %s", s.instanceID, conf.ScheduleTagDay, *tag.Value)
-				}
+		log.Printf("\n")
+	}
+
+	return result, events, nil
+}
+
+// set the expected state of every instance
+// return what should be done and why
+func plan(schedulers []*scheduler, now time.Time) []planEntry {
+	entries := []planEntry{}
+	for _, s := range schedulers {
+		s.expectedState, s.reason = s.shouldRun(s.localTime(now))
+
+		// stopping it would have the group replace it
+		if s.autoScalingGroup != "" {
+			s.expectedState, s.reason = s.instanceState, fmt.Sprintf("scheduled with Auto Scaling group %s", s.autoScalingGroup)
+		}
+
+		// RDS restarts a database stopped for 7 days, see keptState
+		if s.restartedByAWS(now) && s.expectedState == lib.StateStopped {
+			s.reason += ", restarted by AWS after 7 days stopped"
+		}
+
+		entries = append(entries, planEntry{
+			Type:          s.resourceType,
+			Account:       s.accountID,
+			Region:        s.region,
+			InstanceID:    s.instanceID,
+			InstanceName:  s.instanceName,
+			CurrentState:  s.instanceState,
+			ExpectedState: s.expectedState,
+			Reason:        s.reason,
+		})
+	}
+
+	return entries
+}
+
+// build a scheduler for every resource, with the driver of its type
+func newSchedulers(ctx context.Context, conf *lambdaConfig, calendars *lib.CalendarStore, drivers []lib.Driver, resources []lib.Resource) []*scheduler {
+	schedulers := []*scheduler{}
+	for _, r := range resources {
+		schedulers = append(schedulers, newScheduler(ctx, conf, calendars, lib.DriverOf(drivers, r.Type), r))
+	}
+
+	return schedulers
+}
+
+// build the scheduler of a resource from its tags, whatever the resource
+func newScheduler(ctx context.Context, conf *lambdaConfig, calendars *lib.CalendarStore, driver lib.Driver, r lib.Resource) *scheduler {
+	var err error
+	s := &scheduler{
+		region:        r.Region,
+		instanceID:    r.ID,
+		instanceName:  r.Name,
+		instanceState: r.State,
+		accountID:     r.Account,
+		resource:      r,
+		driver:        driver,
+		resourceType:  r.Type,
+		location:      time.UTC,
+		interval:      conf.ScheduleInterval,
+		warn:          conf.ScheduleWarn,
+	}
+
+	// ScheduleFrom/ScheduleUntil/ScheduleSuspendUntil are parsed once the timezone is known
+	var activeFrom, activeUntil, suspendUntil, stoppedAt string
+	var dayErr error
+	for key, value := range r.Tags {
+		// scheduler suspended or disabled, the schedule is still parsed to apply it once unsuspended
+		if key == conf.ScheduleTag && lib.ScheduleDisabled(value) {
+			s.suspended = true
+		}
+
+		// state to keep while suspended
+		if key == conf.ScheduleTagSuspendMode {
+			s.suspendMode, err = lib.ParseSuspendMode(value)
+			if err != nil {
+				log.Printf("[%s] %s in wrong format %s: %s", s.logID(), conf.ScheduleTagSuspendMode, value, err)
 			}
 		}
 
-		// get instance expected state (running, stopped)
-		expectedState := s.shouldRun(time.Now(), time.Date(0000, 01, 01, time.Now().Hour(), time.Now().Minute(), 00, 00, time.UTC))
-		stateChange, err := s.fixInstanceState(ctx, client, expectedState)
-		if err != nil {
-			log.Printf("[%s] unable to change state", s.instanceID)
-			continue
+		// left to ec2scheduler-suspend-mon if the engine doesn't unsuspend
+		if key == conf.ScheduleTagSuspend && conf.UnsuspendExpired {
+			suspendUntil = value
+		}
+
+		// launched by an Auto Scaling group
+		if key == lib.AutoScalingGroupTag {
+			s.autoScalingGroup = value
+		}
+
+		// RDS database stopped by the scheduler
+		if key == conf.ScheduleTagStopped {
+			stoppedAt = value
 		}
 
-		// publish state changes to SNS topic
-		if s.snsTopicArn != "" && stateChange != "" {
-			client := sns.NewFromConfig(cfg)
+		// SNS topic Arn
+		if key == conf.ScheduleTagSNS {
+			s.notifyTargets = parseNotifyTargets(value)
+		}
+
+		if key == conf.ScheduleTag {
+			s.schedule = value
+		}
 
-			err := s.publishStateChange(client, stateChange)
+		// notice before a stop, overrides the default
+		if key == conf.ScheduleTagWarn {
+			s.warn, err = time.ParseDuration(value)
 			if err != nil {
-				log.Printf("[%s] unable to notify %s of state change: %s", s.instanceID, s.snsTopicArn, err)
+				log.Printf("[%s] %s in wrong format %s: %s", s.logID(), conf.ScheduleTagWarn, value, err)
+				s.warn = conf.ScheduleWarn
 			}
+		}
+		if key == conf.ScheduleTagWarned {
+			s.warnedStop = value
+		}
 
-			log.Printf("[%s] notify %s of state change", s.instanceID, s.snsTopicArn)
+		// get timezone (IANA name) from scheduleTagTZ
+		if key == conf.ScheduleTagTZ {
+			s.location, err = lib.LoadLocation(value)
+			if err != nil {
+				log.Printf("[%s] unknown timezone %s, using UTC: %s", s.logID(), value, err)
+			}
 		}
 
-		log.Printf("\n")
+		// get holiday calendar from scheduleTagCalendar
+		if key == conf.ScheduleTagCalendar {
+			s.calendar, err = calendars.Load(ctx, value)
+			if err != nil {
+				log.Printf("[%s] unable to load calendar %s: %s", s.logID(), value, err)
+			}
+		}
+
+		if key == conf.ScheduleTagFrom {
+			activeFrom = value
+		}
+		if key == conf.ScheduleTagUntil {
+			activeUntil = value
+		}
+
+		// get week days from scheduleTagDay
+		if key == conf.ScheduleTagDay {
+			s.weekdays, err = lib.ParseScheduleDay(value)
+			if err != nil {
+				// not the Mon-Fri default, the resource is left as it is (see evaluate)
+				dayErr = fmt.Errorf("%s %s: %s", conf.ScheduleTagDay, value, err)
+				log.Printf("[%s] unable to unmarshal %s: %s", s.logID(), conf.ScheduleTagDay, value)
+			}
+		}
 	}
 
-	return nil
+	// get start and stop cron expressions or time windows from scheduleTag
+	// parsed once every tag is read, a wrong schedule doesn't hide the other tags
+	if lib.IsCronSchedule(lib.EnableSchedule(s.schedule)) {
+		s.cronStart, s.cronStop, err = lib.ParseCronSchedule(lib.EnableSchedule(s.schedule))
+		if err != nil {
+			s.scheduleErr = err
+			log.Printf("[%s] scheduler cron in wrong format %s: %s", s.logID(), s.schedule, err)
+		}
+	} else {
+		s.windows, err = lib.ParseWindows(lib.EnableSchedule(s.schedule))
+		if err != nil {
+			s.scheduleErr = err
+			log.Printf("[%s] scheduler in wrong format %s: %s", s.logID(), s.schedule, err)
+		}
+	}
+
+	if s.scheduleErr == nil && dayErr != nil {
+		s.scheduleErr = dayErr
+	}
+
+	// get the end of the suspension
+	if suspendUntil != "" {
+		s.suspendUntil, err = lib.ParseDate(suspendUntil, s.location)
+		if err != nil {
+			log.Printf("[%s] %s in wrong format %s: %s", s.logID(), conf.ScheduleTagSuspend, suspendUntil, err)
+		}
+	}
+
+	if stoppedAt != "" {
+		s.stoppedAt, err = time.Parse(time.RFC3339, stoppedAt)
+		if err != nil {
+			log.Printf("[%s] %s in wrong format %s: %s", s.logID(), conf.ScheduleTagStopped, stoppedAt, err)
+		}
+	}
+
+	// get dates the schedule is active from/until
+	if activeFrom != "" {
+		s.activeFrom, err = lib.ParseDate(activeFrom, s.location)
+		if err != nil {
+			log.Printf("[%s] %s in wrong format %s: %s", s.logID(), conf.ScheduleTagFrom, activeFrom, err)
+		}
+	}
+	if activeUntil != "" {
+		s.activeUntil, err = lib.ParseDate(activeUntil, s.location)
+		if err != nil {
+			log.Printf("[%s] %s in wrong format %s: %s", s.logID(), conf.ScheduleTagUntil, activeUntil, err)
+		}
+	}
+
+	return s
+}
+
+// instance reference in the logs, with its region when known
+func (s *scheduler) logID() string {
+	if s.region == "" {
+		return s.instanceID
+	}
+	return s.region + "/" + s.instanceID
+}
+
+// convert t to the instance timezone
+// return the local date and the local time (null value for YYYY, mm, dd), as expected by shouldRun
+func (s *scheduler) localTime(t time.Time) (time.Time, time.Time) {
+	location := s.location
+	if location == nil {
+		location = time.UTC
+	}
+
+	dateNow := t.In(location)
+	return dateNow, time.Date(0000, 01, 01, dateNow.Hour(), dateNow.Minute(), 00, 00, time.UTC)
 }
 
 // splitting time and date logic
 // dateNow contains information regarding current date and time
 // timeNow contains information regarding current time (null value for YYYY, mm, dd)
-func (s *scheduler) shouldRun(dateNow, timeNow time.Time) types.InstanceStateName {
+// return the expected state and the reason for it
+func (s *scheduler) shouldRun(dateNow, timeNow time.Time) (lib.State, string) {
 	// logging
-	log.Printf("[%s] time now: %d:%d", s.instanceID, timeNow.Hour(), timeNow.Minute())
-	log.Printf("[%s] weekday: %s", s.instanceID, dateNow.Weekday())
-	log.Printf("[%s] start time: %d:%d", s.instanceID, s.startTime.Hour(), s.startTime.Minute())
-	log.Printf("[%s] stop time: %d:%d", s.instanceID, s.stopTime.Hour(), s.stopTime.Minute())
+	log.Printf("[%s] time now: %d:%d (%s)", s.logID(), timeNow.Hour(), timeNow.Minute(), dateNow.Location())
+	log.Printf("[%s] weekday: %s", s.logID(), dateNow.Weekday())
+	log.Printf("[%s] time windows: %s", s.logID(), s.windows)
+	if s.cronStart != nil || s.cronStop != nil {
+		log.Printf("[%s] cron start: %s, cron stop: %s", s.logID(), s.cronStart, s.cronStop)
+	}
 
-	// scheduler suspended
-	if s.suspended {
-		log.Printf("[%s] scheduler is suspended", s.instanceID)
-		return s.instanceState
+	// suspension expired, unsuspended in this run (see unsuspend): apply the schedule
+	if s.suspended && s.suspendExpired(dateNow) {
+		log.Printf("[%s] suspension expired on %s", s.logID(), s.suspendUntil)
 	}
 
-	// should not run today
-	if !s.shouldRunDay(dateNow.Weekday()) {
-		log.Printf("[%s] should not run on %s", s.instanceID, dateNow.Weekday())
-		return types.InstanceStateNameStopped
+	state, reason := s.evaluate(dateNow, timeNow)
+	log.Printf("[%s] %s: %s", s.logID(), state, reason)
+	return state, reason
+}
+
+// expected state and reason at dateNow/timeNow, without logging
+// also used to look ahead for the next stop (see nextStop)
+func (s *scheduler) evaluate(dateNow, timeNow time.Time) (lib.State, string) {
+	// scheduler suspended, enforce the suspend mode if any
+	if s.suspended && !s.suspendExpired(dateNow) {
+		switch s.suspendMode {
+		case lib.SuspendModeRunning:
+			return lib.StateRunning, "scheduler is suspended, kept running"
+		case lib.SuspendModeStopped:
+			return lib.StateStopped, "scheduler is suspended, kept stopped"
+		}
+		return s.instanceState, "scheduler is suspended"
+	}
+
+	// schedule can't be parsed, leave the instance as it is (ScheduleInvalid event)
+	if s.scheduleErr != nil {
+		return s.instanceState, fmt.Sprintf("invalid schedule, left as it is: %s", s.scheduleErr)
+	}
+
+	// schedule not active yet, leave the instance as it is
+	if !s.activeFrom.IsZero() && dateNow.Before(s.activeFrom) {
+		return s.keptState(dateNow), fmt.Sprintf("scheduler active from %s", s.activeFrom)
+	}
+
+	// schedule expired, stop the instance for good
+	if s.expired(dateNow) {
+		return lib.StateStopped, fmt.Sprintf("scheduler expired on %s", s.activeUntil)
+	}
+
+	// should not run on holidays, the name read from the calendar isn't repeated
+	if _, ok := s.calendar.Holiday(dateNow); ok {
+		return lib.StateStopped, fmt.Sprintf("should not run on holiday %s", dateNow.Format("2006-01-02"))
+	}
+
+	if s.cronStart != nil || s.cronStop != nil {
+		return s.shouldRunCron(dateNow)
 	}
 
-	// startTime-stopTime same day (07:00-19:30)
-	if s.startTime.Before(s.stopTime) {
-		if timeNow.After(s.startTime) && timeNow.Before(s.stopTime) {
-			return types.InstanceStateNameRunning
+	runDay := false
+	for _, w := range s.windows {
+		if !s.shouldRunWindowDay(w, dateNow.Weekday()) {
+			continue
 		}
 
-		return types.InstanceStateNameStopped
+		runDay = true
+		if w.Contains(timeNow) {
+			return lib.StateRunning, fmt.Sprintf("inside time window %s", w)
+		}
 	}
 
-	// startTime-stopTime between days (22:00-03:00 = 22:00-23:59,00:00-03:00)
-	// startTime-midnight
-	if timeNow.After(s.startTime) && timeNow.Before(time.Date(0000, 01, 01, 23, 59, 00, 00, time.UTC)) {
-		return types.InstanceStateNameRunning
+	// should not run today
+	if !runDay {
+		return lib.StateStopped, fmt.Sprintf("should not run on %s", dateNow.Weekday())
 	}
-	// midnight-stopTime
-	if timeNow.After(time.Date(0000, 01, 01, 00, 00, 00, 00, time.UTC)) && timeNow.Before(s.stopTime) {
-		return types.InstanceStateNameRunning
+
+	return lib.StateStopped, "outside time windows"
+}
+
+// cron schedule: start or stop if the expression fired since the previous engine run
+// (interval before dateNow), otherwise leave the instance as it is
+// if both fired, the latest wins
+func (s *scheduler) shouldRunCron(dateNow time.Time) (lib.State, string) {
+	to := dateNow.Truncate(time.Minute)
+	from := to.Add(-s.interval)
+
+	start, started := s.cronStart.LastBetween(from, to)
+	stop, stopped := s.cronStop.LastBetween(from, to)
+
+	if started && (!stopped || start.After(stop)) {
+		return lib.StateRunning, fmt.Sprintf("cron start fired at %s", start)
 	}
+	if stopped {
+		return lib.StateStopped, fmt.Sprintf("cron stop fired at %s", stop)
+	}
+
+	return s.keptState(dateNow), "no cron start or stop since the previous run"
+}
 
-	return types.InstanceStateNameStopped
+// check if the suspension is over (scheduleTagSuspend)
+func (s *scheduler) suspendExpired(dateNow time.Time) bool {
+	return !s.suspendUntil.IsZero() && !dateNow.Before(s.suspendUntil)
+}
+
+// check if the schedule is over (scheduleTagUntil)
+func (s *scheduler) expired(dateNow time.Time) bool {
+	return !s.activeUntil.IsZero() && !dateNow.Before(s.activeUntil)
 }
 
 // check if instance should run based on day of the week
@@ -228,47 +798,178 @@ func (s *scheduler) shouldRunDay(weekday time.Weekday) bool {
 	return false
 }
 
-// fix instance state - start or stop
-// return instance state and a possible error
-func (s *scheduler) fixInstanceState(ctx context.Context, client ec2ClientAPI, expectedState types.InstanceStateName) (types.InstanceStateName, error) {
-	if s.instanceState == expectedState {
-		log.Printf("[%s] instance %s. Nothing to do", s.instanceID, s.instanceState)
-		return "", nil
+// check if the window applies to the day of the week
+// windows without their own days follow scheduleTagDay
+func (s *scheduler) shouldRunWindowDay(w lib.TimeWindow, weekday time.Weekday) bool {
+	if w.Weekdays == nil {
+		return s.shouldRunDay(weekday)
+	}
+
+	for _, d := range w.Weekdays {
+		if d == weekday {
+			return true
+		}
 	}
 
-	if expectedState == types.InstanceStateNameRunning {
-		if _, err := client.StartInstances(ctx, &ec2.StartInstancesInput{
-			InstanceIds: []string{s.instanceID},
-		}); err != nil {
-			return "", err
+	return false
+}
+
+// start or stop the resources, each driver once with all of its resources (EC2 batches its calls)
+// return the state change (empty if nothing to do) and a possible error of every resource
+func changeStates(ctx context.Context, conf *lambdaConfig, schedulers []*scheduler) map[*scheduler]stateChange {
+	changes := map[*scheduler]stateChange{}
+
+	drivers := []lib.Driver{}
+	toStart, toStop := map[lib.Driver][]*scheduler{}, map[lib.Driver][]*scheduler{}
+	for _, s := range schedulers {
+		if _, ok := toStart[s.driver]; !ok {
+			drivers = append(drivers, s.driver)
+			toStart[s.driver], toStop[s.driver] = []*scheduler{}, []*scheduler{}
 		}
 
-		log.Printf("[%s] state changed to %s", s.instanceID, types.InstanceStateNameRunning)
-		return types.InstanceStateNameRunning, nil
+		switch {
+		case s.autoScalingGroup != "":
+			log.Printf("[%s] member of Auto Scaling group %s, scheduled with the group. Skipping", s.logID(), s.autoScalingGroup)
+			changes[s] = stateChange{}
+		case s.instanceState == s.expectedState:
+			log.Printf("[%s] %s %s. Nothing to do", s.logID(), s.resourceType, s.instanceState)
+			changes[s] = stateChange{}
+
+			// started within RDSMaxStopped of the stop, by someone else than AWS: not the scheduler stop anymore
+			if s.instanceState == lib.StateRunning && !s.stoppedAt.IsZero() {
+				if err := s.driver.DeleteTags(ctx, s.resource, conf.ScheduleTagStopped); err != nil {
+					log.Printf("[%s] unable to remove %s: %s", s.logID(), conf.ScheduleTagStopped, err)
+				}
+			}
+		case s.expectedState == lib.StateRunning:
+			toStart[s.driver] = append(toStart[s.driver], s)
+		case s.expectedState == lib.StateStopped:
+			toStop[s.driver] = append(toStop[s.driver], s)
+		}
+	}
+
+	for _, driver := range drivers {
+		changeDriverStates(ctx, driver.Start, toStart[driver], lib.StateRunning, changes)
+		changeDriverStates(ctx, driver.Stop, toStop[driver], lib.StateStopped, changes)
+	}
+
+	return changes
+}
+
+// call change (a driver Start or Stop) with the resources of schedulers and record the result of every one
+func changeDriverStates(ctx context.Context, change func(ctx context.Context, resources []lib.Resource) []error, schedulers []*scheduler, state lib.State, changes map[*scheduler]stateChange) {
+	if len(schedulers) < 1 {
+		return
+	}
+
+	resources := []lib.Resource{}
+	for _, s := range schedulers {
+		resources = append(resources, s.resource)
 	}
 
-	if expectedState == types.InstanceStateNameStopped {
-		if _, err := client.StopInstances(ctx, &ec2.StopInstancesInput{
-			InstanceIds: []string{s.instanceID},
-		}); err != nil {
-			return "", err
+	errs := change(ctx, resources)
+	for i, s := range schedulers {
+		switch {
+		case errors.Is(errs[i], lib.ErrUnchanged):
+			log.Printf("[%s] %s", s.logID(), errs[i])
+			changes[s] = stateChange{}
+		case errs[i] != nil:
+			changes[s] = stateChange{err: errs[i]}
+		default:
+			changes[s] = stateChange{state: state}
 		}
+	}
+}
+
+// comment out scheduleTag, the same way ec2scheduler-disable does
+// ec2scheduler-enable restores it
+func (s *scheduler) disableSchedule(ctx context.Context, conf *lambdaConfig) error {
+	err := s.driver.CreateTags(ctx, s.resource, map[string]string{
+		conf.ScheduleTag:               lib.DisableSchedule(s.schedule),
+		conf.ScheduleTagDisabledBy:     "ec2scheduler",
+		conf.ScheduleTagDisabledReason: fmt.Sprintf("%s %s expired", conf.ScheduleTagUntil, s.activeUntil.Format("2006-01-02 15:04")),
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Printf("[%s] scheduler expired, %s tag commented out", s.logID(), conf.ScheduleTag)
+	return nil
+}
 
-		log.Printf("[%s] state changed to %s", s.instanceID, types.InstanceStateNameStopped)
-		return types.InstanceStateNameStopped, nil
+// uncomment scheduleTag and remove the suspend tags, as ec2scheduler-unsuspend does
+func (s *scheduler) unsuspend(ctx context.Context, conf *lambdaConfig) error {
+	err := s.driver.DeleteTags(ctx, s.resource, conf.ScheduleTagSuspend, conf.ScheduleTagSuspendMode)
+	if err != nil {
+		return err
 	}
 
-	return "", nil
+	err = s.driver.CreateTags(ctx, s.resource, map[string]string{
+		conf.ScheduleTag: lib.EnableSchedule(s.schedule),
+	})
+	if err != nil {
+		return err
+	}
+
+	s.suspended = false
+	s.suspendMode = ""
+	s.schedule = lib.EnableSchedule(s.schedule)
+
+	log.Printf("[%s] suspension expired, scheduler unsuspended", s.logID())
+	return nil
 }
 
-func (s *scheduler) publishStateChange(client *sns.Client, stateChange types.InstanceStateName) error {
-	_, err := client.Publish(context.Background(), &sns.PublishInput{
-		Message:  aws.String(fmt.Sprintf("%s (%s) state changed to %s", s.instanceID, s.instanceName, stateChange)),
-		TopicArn: aws.String(s.snsTopicArn),
+// first time within the warn notice (after now) the instance is expected to be stopped
+// it is stepped a minute at a time, the resolution of the schedules
+func (s *scheduler) nextStop(now time.Time) (time.Time, bool) {
+	now = now.Truncate(time.Minute)
+	for t := now.Add(time.Minute); !t.After(now.Add(s.warn)); t = t.Add(time.Minute) {
+		if state, _ := s.evaluate(s.localTime(t)); state == lib.StateStopped {
+			return t, true
+		}
+	}
+
+	return time.Time{}, false
+}
+
+// publish a warning to the SNS topic if the instance is about to be stopped
+// the stop is recorded in scheduleTagWarned, so that it is warned about only once
+func (s *scheduler) warnStop(ctx context.Context, notifiers *notifiers, conf *lambdaConfig, now time.Time) error {
+	if s.warn <= 0 || s.instanceState != lib.StateRunning {
+		return nil
+	}
+
+	stop, ok := s.nextStop(now)
+	if !ok {
+		return nil
+	}
+
+	stopDate, _ := s.localTime(stop)
+	if stopDate.Format(lib.SuspendLayout) == s.warnedStop {
+		log.Printf("[%s] stop at %s already warned about", s.logID(), stopDate.Format("15:04 MST"))
+		return nil
+	}
+
+	_, reason := s.evaluate(s.localTime(stop))
+	n := s.newNotification(conf, eventStopWarning, lib.StateStopped, reason, now)
+	stopAt := stop.UTC()
+	n.StopAt = &stopAt
+	n.Subject = fmt.Sprintf("%s (%s) will stop in %d minutes, at %s. Suspend the scheduler to postpone",
+		s.instanceID, s.instanceName, int(stop.Sub(now.Truncate(time.Minute)).Minutes()), stopDate.Format("15:04 MST"))
+
+	err := s.notify(ctx, notifiers, n)
+	if err != nil {
+		return err
+	}
+
+	err = s.driver.CreateTags(ctx, s.resource, map[string]string{
+		conf.ScheduleTagWarned: stopDate.Format(lib.SuspendLayout),
 	})
 	if err != nil {
 		return err
 	}
 
+	s.warnedStop = stopDate.Format(lib.SuspendLayout)
+	log.Printf("[%s] stop at %s warned about", s.logID(), stopDate.Format("15:04 MST"))
 	return nil
 }
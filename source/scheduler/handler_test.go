@@ -6,25 +6,182 @@ import (
 	"testing"
 	"time"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/ec2"
 	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/caarlos0/env/v6"
+	"github.com/dwtechnologies/ec2scheduler/source/lib"
+	"github.com/dwtechnologies/ec2scheduler/source/lib/libtest"
 	"github.com/stretchr/testify/assert"
 )
 
-var _ ec2ClientAPI = (*mockEC2client)(nil)
+const instanceID = "i-07d023c826d243165"
+
+var _ snsClientAPI = (*mockSNSclient)(nil)
+
+type mockSNSclient struct {
+	err    error
+	inputs []*sns.PublishInput
+}
+
+func (m *mockSNSclient) Publish(ctx context.Context, params *sns.PublishInput, optFns ...func(*sns.Options)) (*sns.PublishOutput, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	m.inputs = append(m.inputs, params)
+	return &sns.PublishOutput{}, nil
+}
+
+var _ lib.EC2API = (*mockEC2client)(nil)
 
+// EC2 client of one page of reservations, recording the started instances
 type mockEC2client struct {
-	err error
+	reservations []types.Reservation
+	started      [][]string
 }
 
-const instanceID = "i-07d023c826d243165"
+func (m *mockEC2client) DescribeInstances(ctx context.Context, params *ec2.DescribeInstancesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeInstancesOutput, error) {
+	return &ec2.DescribeInstancesOutput{Reservations: m.reservations}, nil
+}
 
 func (m *mockEC2client) StartInstances(ctx context.Context, params *ec2.StartInstancesInput, optFns ...func(*ec2.Options)) (*ec2.StartInstancesOutput, error) {
-	return &ec2.StartInstancesOutput{}, m.err
+	m.started = append(m.started, params.InstanceIds)
+	resp := &ec2.StartInstancesOutput{}
+	for _, id := range params.InstanceIds {
+		resp.StartingInstances = append(resp.StartingInstances, types.InstanceStateChange{InstanceId: aws.String(id)})
+	}
+	return resp, nil
 }
 
 func (m *mockEC2client) StopInstances(ctx context.Context, params *ec2.StopInstancesInput, optFns ...func(*ec2.Options)) (*ec2.StopInstancesOutput, error) {
-	return &ec2.StopInstancesOutput{}, m.err
+	return &ec2.StopInstancesOutput{}, nil
+}
+
+func (m *mockEC2client) CreateTags(ctx context.Context, params *ec2.CreateTagsInput, optFns ...func(*ec2.Options)) (*ec2.CreateTagsOutput, error) {
+	return &ec2.CreateTagsOutput{}, nil
+}
+
+func (m *mockEC2client) DeleteTags(ctx context.Context, params *ec2.DeleteTagsInput, optFns ...func(*ec2.Options)) (*ec2.DeleteTagsOutput, error) {
+	return &ec2.DeleteTagsOutput{}, nil
+}
+
+// stopped instance with the given tags
+func TestNewSchedulers(t *testing.T) {
+	conf := &lambdaConfig{}
+	assert.NoError(t, env.Parse(conf))
+
+	resources := []lib.Resource{
+		{Type: lib.ResourceTypeInstance, ID: "i-1", Name: "web-1", Region: "eu-west-1", State: lib.StateStopped, Tags: map[string]string{"Schedule": "07:00-19:00"}},
+		{Type: lib.ResourceTypeInstance, ID: "i-2", Name: "web-2", Account: "123456789012", Region: "eu-west-1", State: lib.StateStopped, Tags: map[string]string{"Schedule": "07:00-19:00"}},
+		{Type: lib.ResourceTypeInstance, ID: "i-3", Name: "web-3", Region: "eu-west-1", State: lib.StateStopped, Tags: map[string]string{"Schedule": "#07:00-19:00", "ScheduleSuspendMode": "keep-stopped"}},
+		{Type: lib.ResourceTypeInstance, ID: "i-4", Name: "batch", Region: "eu-west-1", State: lib.StateStopped, Tags: map[string]string{"Schedule": "06:00-09:00,18:00-22:00", "ScheduleDay": "1,3"}},
+		{Type: lib.ResourceTypeInstance, ID: "i-5", Name: "db-1", Region: "eu-west-1", State: lib.StateStopped, Tags: map[string]string{"Schedule": "08:00-17:00"}},
+		{Type: lib.ResourceTypeInstance, ID: "i-6", Name: "db-2", Region: "eu-west-1", State: lib.StateStopped, Tags: map[string]string{"Schedule": "08:00-17:00", "ScheduleTimezone": "Europe/Stockholm"}},
+		{Type: lib.ResourceTypeInstance, ID: "i-7", Name: "ci", Region: "eu-west-1", State: lib.StateStopped, Tags: map[string]string{"Schedule": "#08:00-17:00", "ScheduleSuspendUntil": "20210111T08:15", "ScheduleTimezone": "Europe/Stockholm"}},
+		{
+			Type:    lib.ResourceTypeDBInstance,
+			ID:      "orders",
+			Name:    "orders",
+			Account: "123456789012",
+			Region:  "eu-west-1",
+			State:   lib.StateStopped,
+			Tags:    map[string]string{"Schedule": "07:00-19:00", "ScheduleStoppedAt": "2021-01-08T19:00:00Z"},
+		},
+	}
+	ec2Driver := libtest.NewFakeDriver(resources[:7]...)
+	rdsDriver := libtest.NewFakeDriver(resources[7])
+
+	got := newSchedulers(context.Background(), conf, lib.NewCalendarStore(nil, nil, lib.CalendarConfig{}), []lib.Driver{ec2Driver, rdsDriver}, resources)
+
+	ids := []string{}
+	for _, s := range got {
+		ids = append(ids, s.instanceID)
+	}
+	assert.Equal(t, []string{"i-1", "i-2", "i-3", "i-4", "i-5", "i-6", "i-7", "orders"}, ids)
+
+	assert.Equal(t, "web-2", got[1].instanceName)
+	assert.Equal(t, "123456789012", got[1].accountID)
+	assert.Equal(t, "eu-west-1", got[1].region)
+	assert.Len(t, got[1].windows, 1)
+	assert.True(t, got[2].suspended)
+	assert.Equal(t, lib.SuspendModeStopped, got[2].suspendMode)
+	assert.Len(t, got[3].windows, 2)
+	assert.Equal(t, []time.Weekday{time.Monday, time.Wednesday}, got[3].weekdays)
+	assert.Equal(t, "db-2", got[5].instanceName)
+	assert.Equal(t, "Europe/Stockholm", got[5].location.String())
+
+	// suspended schedule is parsed, to apply it once the suspension expires (07:15 UTC)
+	assert.True(t, got[6].suspended)
+	assert.Len(t, got[6].windows, 1)
+	assert.Equal(t, time.Date(2021, 01, 11, 7, 15, 00, 00, time.UTC), got[6].suspendUntil.UTC())
+
+	// resources get the driver of their type
+	assert.Equal(t, lib.Driver(ec2Driver), got[0].driver)
+	assert.Equal(t, lib.ResourceTypeInstance, got[0].resourceType)
+	assert.Equal(t, lib.Driver(rdsDriver), got[7].driver)
+	assert.Equal(t, lib.ResourceTypeDBInstance, got[7].resourceType)
+	assert.Equal(t, time.Date(2021, 01, 8, 19, 00, 00, 00, time.UTC), got[7].stoppedAt)
+
+	for _, s := range got {
+		if s.suspended {
+			continue
+		}
+		got, _ := s.shouldRun(s.localTime(time.Date(2021, 01, 11, 8, 30, 00, 00, time.UTC))) // Monday
+		assert.Equal(t, lib.StateRunning, got, s.instanceID)
+	}
+}
+
+func TestNewSchedulerInvalid(t *testing.T) {
+	conf := &lambdaConfig{}
+	assert.NoError(t, env.Parse(conf))
+	calendars := lib.NewCalendarStore(nil, nil, lib.CalendarConfig{})
+
+	tests := []struct {
+		name string
+		tags map[string]string
+		err  bool
+	}{
+		{
+			name: "invalid time",
+			tags: map[string]string{"Schedule": "07:00-25:00"},
+			err:  true,
+		},
+		{
+			name: "invalid cron",
+			tags: map[string]string{"Schedule": "start=0 7 * *"},
+			err:  true,
+		},
+		{
+			name: "valid",
+			tags: map[string]string{"Schedule": "07:00-19:00"},
+		},
+		{
+			// not the Mon-Fri default
+			name: "invalid day",
+			tags: map[string]string{"Schedule": "07:00-19:00", "ScheduleDay": "1,9"},
+			err:  true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sch := newScheduler(context.Background(), conf, calendars, nil, lib.Resource{Type: lib.ResourceTypeInstance, ID: "i-1", Tags: test.tags})
+			assert.Equal(t, test.err, sch.scheduleErr != nil)
+		})
+	}
+
+	// the other tags are read whatever the schedule
+	sch := newScheduler(context.Background(), conf, calendars, nil, lib.Resource{Type: lib.ResourceTypeInstance, ID: "i-1", Tags: map[string]string{
+		"Schedule":              "07:00-25:00",
+		"ScheduleTimezone":      "Europe/Stockholm",
+		"ScheduleDay":           "1,2",
+		lib.AutoScalingGroupTag: "web",
+	}})
+	assert.Error(t, sch.scheduleErr)
+	assert.Equal(t, "Europe/Stockholm", sch.location.String())
+	assert.Equal(t, []time.Weekday{time.Monday, time.Tuesday}, sch.weekdays)
+	assert.Equal(t, "web", sch.autoScalingGroup)
 }
 
 func TestShouldRunDay(t *testing.T) {
@@ -86,86 +243,300 @@ func TestShouldRun(t *testing.T) {
 		sch     *scheduler
 		dateNow time.Time
 		timeNow time.Time
-		want    types.InstanceStateName
+		want    lib.State
 	}{
 		{
 			name: "weekend and scheduler suspended",
 			sch: &scheduler{
 				instanceID:    instanceID,
-				instanceState: types.InstanceStateNameRunning,
+				instanceState: lib.StateRunning,
 				suspended:     true,
 			},
 			dateNow: time.Date(2019, 01, 06, 00, 00, 00, 00, time.UTC), // Sunday
 			timeNow: time.Date(0000, 01, 01, 00, 00, 00, 00, time.UTC), // Sunday
-			want:    types.InstanceStateNameRunning,
+			want:    lib.StateRunning,
+		},
+		{
+			name: "invalid schedule - left running",
+			sch: &scheduler{
+				instanceID:    instanceID,
+				instanceState: lib.StateRunning,
+				scheduleErr:   fmt.Errorf("invalid time window 07:00-25:00"),
+			},
+			dateNow: time.Date(2019, 01, 06, 00, 00, 00, 00, time.UTC), // Sunday
+			timeNow: time.Date(0000, 01, 01, 00, 00, 00, 00, time.UTC), // Sunday
+			want:    lib.StateRunning,
+		},
+		{
+			name: "scheduler suspended - keep running",
+			sch: &scheduler{
+				instanceID:    instanceID,
+				instanceState: lib.StateStopped,
+				suspended:     true,
+				suspendMode:   lib.SuspendModeRunning,
+			},
+			dateNow: time.Date(2019, 01, 06, 00, 00, 00, 00, time.UTC), // Sunday
+			timeNow: time.Date(0000, 01, 01, 00, 00, 00, 00, time.UTC), // Sunday
+			want:    lib.StateRunning,
+		},
+		{
+			name: "scheduler suspension expired - keep running ignored",
+			sch: &scheduler{
+				instanceID:    instanceID,
+				instanceState: lib.StateRunning,
+				suspended:     true,
+				suspendMode:   lib.SuspendModeRunning,
+				suspendUntil:  time.Date(2019, 01, 07, 9, 00, 00, 00, time.UTC),
+				windows: []lib.TimeWindow{
+					{
+						StartTime: time.Date(0000, 01, 01, 10, 00, 00, 00, time.UTC),
+						StopTime:  time.Date(0000, 01, 01, 19, 00, 00, 00, time.UTC),
+					},
+				},
+			},
+			dateNow: time.Date(2019, 01, 07, 9, 30, 00, 00, time.UTC), // Monday
+			timeNow: time.Date(0000, 01, 01, 9, 30, 00, 00, time.UTC),
+			want:    lib.StateStopped,
+		},
+		{
+			name: "scheduler suspended - keep stopped",
+			sch: &scheduler{
+				instanceID:    instanceID,
+				instanceState: lib.StateRunning,
+				suspended:     true,
+				suspendMode:   lib.SuspendModeStopped,
+				windows: []lib.TimeWindow{
+					{
+						StartTime: time.Date(0000, 01, 01, 8, 00, 00, 00, time.UTC),
+						StopTime:  time.Date(0000, 01, 01, 19, 00, 00, 00, time.UTC),
+					},
+				},
+			},
+			dateNow: time.Date(2019, 01, 07, 10, 00, 00, 00, time.UTC), // Monday
+			timeNow: time.Date(0000, 01, 01, 10, 00, 00, 00, time.UTC),
+			want:    lib.StateStopped,
 		},
 
 		{
 			name: "weekend",
 			sch: &scheduler{
 				instanceID: instanceID,
-				startTime:  time.Date(0000, 01, 01, 8, 00, 00, 00, time.UTC),
-				stopTime:   time.Date(0000, 01, 01, 19, 00, 00, 00, time.UTC),
+				windows: []lib.TimeWindow{
+					{
+						StartTime: time.Date(0000, 01, 01, 8, 00, 00, 00, time.UTC),
+						StopTime:  time.Date(0000, 01, 01, 19, 00, 00, 00, time.UTC),
+					},
+				},
 			},
 			dateNow: time.Date(2019, 01, 06, 00, 00, 00, 00, time.UTC), // Sunday
 			timeNow: time.Date(0000, 01, 01, 00, 00, 00, 00, time.UTC), // Sunday
-			want:    types.InstanceStateNameStopped,
+			want:    lib.StateStopped,
 		},
 		{
 			name: "startTime:stopTime same day",
 			sch: &scheduler{
 				instanceID: instanceID,
-				startTime:  time.Date(0000, 01, 0, 8, 00, 00, 00, time.UTC),
-				stopTime:   time.Date(0000, 01, 03, 19, 00, 00, 00, time.UTC),
+				windows: []lib.TimeWindow{
+					{
+						StartTime: time.Date(0000, 01, 0, 8, 00, 00, 00, time.UTC),
+						StopTime:  time.Date(0000, 01, 03, 19, 00, 00, 00, time.UTC),
+					},
+				},
 			},
 			timeNow: time.Date(0000, 01, 01, 10, 00, 00, 00, time.UTC),
-			want:    types.InstanceStateNameRunning,
+			want:    lib.StateRunning,
 		},
 		{
 			name: "startTime:stopTime same day - out of range",
 			sch: &scheduler{
 				instanceID: instanceID,
-				startTime:  time.Date(0000, 01, 01, 8, 00, 00, 00, time.UTC),
-				stopTime:   time.Date(0000, 01, 01, 19, 00, 00, 00, time.UTC),
+				windows: []lib.TimeWindow{
+					{
+						StartTime: time.Date(0000, 01, 01, 8, 00, 00, 00, time.UTC),
+						StopTime:  time.Date(0000, 01, 01, 19, 00, 00, 00, time.UTC),
+					},
+				},
 			},
 			timeNow: time.Date(0000, 01, 01, 20, 00, 00, 00, time.UTC),
-			want:    types.InstanceStateNameStopped,
+			want:    lib.StateStopped,
 		},
 		{
 			name: "startTime:stopTime between days - before midnight",
 			sch: &scheduler{
 				instanceID: instanceID,
-				startTime:  time.Date(0000, 01, 01, 19, 00, 00, 00, time.UTC),
-				stopTime:   time.Date(0000, 01, 01, 7, 30, 00, 00, time.UTC),
+				windows: []lib.TimeWindow{
+					{
+						StartTime: time.Date(0000, 01, 01, 19, 00, 00, 00, time.UTC),
+						StopTime:  time.Date(0000, 01, 01, 7, 30, 00, 00, time.UTC),
+					},
+				},
 			},
 			timeNow: time.Date(0000, 01, 01, 23, 00, 00, 00, time.UTC),
-			want:    types.InstanceStateNameRunning,
+			want:    lib.StateRunning,
 		},
 		{
 			name: "startTime:stopTime between days - after midnight",
 			sch: &scheduler{
 				instanceID: instanceID,
-				startTime:  time.Date(0000, 01, 01, 19, 00, 00, 00, time.UTC),
-				stopTime:   time.Date(0000, 01, 01, 7, 30, 00, 00, time.UTC),
+				windows: []lib.TimeWindow{
+					{
+						StartTime: time.Date(0000, 01, 01, 19, 00, 00, 00, time.UTC),
+						StopTime:  time.Date(0000, 01, 01, 7, 30, 00, 00, time.UTC),
+					},
+				},
 			},
 			timeNow: time.Date(0000, 01, 01, 3, 00, 00, 00, time.UTC),
-			want:    types.InstanceStateNameRunning,
+			want:    lib.StateRunning,
 		},
 		{
 			name: "startTime:stopTime between days - out of range",
 			sch: &scheduler{
 				instanceID: instanceID,
-				startTime:  time.Date(0000, 01, 01, 19, 00, 00, 00, time.UTC),
-				stopTime:   time.Date(0000, 01, 01, 7, 30, 00, 00, time.UTC),
+				windows: []lib.TimeWindow{
+					{
+						StartTime: time.Date(0000, 01, 01, 19, 00, 00, 00, time.UTC),
+						StopTime:  time.Date(0000, 01, 01, 7, 30, 00, 00, time.UTC),
+					},
+				},
 			},
 			timeNow: time.Date(0000, 01, 01, 8, 00, 00, 00, time.UTC),
-			want:    types.InstanceStateNameStopped,
+			want:    lib.StateStopped,
+		},
+		{
+			name: "multiple windows - first window",
+			sch: &scheduler{
+				instanceID: instanceID,
+				windows: []lib.TimeWindow{
+					{
+						StartTime: time.Date(0000, 01, 01, 6, 00, 00, 00, time.UTC),
+						StopTime:  time.Date(0000, 01, 01, 9, 00, 00, 00, time.UTC),
+					},
+					{
+						StartTime: time.Date(0000, 01, 01, 18, 00, 00, 00, time.UTC),
+						StopTime:  time.Date(0000, 01, 01, 22, 00, 00, 00, time.UTC),
+					},
+				},
+			},
+			timeNow: time.Date(0000, 01, 01, 7, 00, 00, 00, time.UTC),
+			want:    lib.StateRunning,
+		},
+		{
+			name: "multiple windows - second window",
+			sch: &scheduler{
+				instanceID: instanceID,
+				windows: []lib.TimeWindow{
+					{
+						StartTime: time.Date(0000, 01, 01, 6, 00, 00, 00, time.UTC),
+						StopTime:  time.Date(0000, 01, 01, 9, 00, 00, 00, time.UTC),
+					},
+					{
+						StartTime: time.Date(0000, 01, 01, 18, 00, 00, 00, time.UTC),
+						StopTime:  time.Date(0000, 01, 01, 22, 00, 00, 00, time.UTC),
+					},
+				},
+			},
+			timeNow: time.Date(0000, 01, 01, 19, 00, 00, 00, time.UTC),
+			want:    lib.StateRunning,
+		},
+		{
+			name: "multiple windows - between windows",
+			sch: &scheduler{
+				instanceID: instanceID,
+				windows: []lib.TimeWindow{
+					{
+						StartTime: time.Date(0000, 01, 01, 6, 00, 00, 00, time.UTC),
+						StopTime:  time.Date(0000, 01, 01, 9, 00, 00, 00, time.UTC),
+					},
+					{
+						StartTime: time.Date(0000, 01, 01, 18, 00, 00, 00, time.UTC),
+						StopTime:  time.Date(0000, 01, 01, 22, 00, 00, 00, time.UTC),
+					},
+				},
+			},
+			timeNow: time.Date(0000, 01, 01, 12, 00, 00, 00, time.UTC),
+			want:    lib.StateStopped,
+		},
+		{
+			name: "multiple windows - overnight window after midnight",
+			sch: &scheduler{
+				instanceID: instanceID,
+				windows: []lib.TimeWindow{
+					{
+						StartTime: time.Date(0000, 01, 01, 12, 00, 00, 00, time.UTC),
+						StopTime:  time.Date(0000, 01, 01, 14, 00, 00, 00, time.UTC),
+					},
+					{
+						StartTime: time.Date(0000, 01, 01, 22, 00, 00, 00, time.UTC),
+						StopTime:  time.Date(0000, 01, 01, 3, 00, 00, 00, time.UTC),
+					},
+				},
+			},
+			timeNow: time.Date(0000, 01, 01, 1, 00, 00, 00, time.UTC),
+			want:    lib.StateRunning,
+		},
+		{
+			name: "windows with days - Friday window",
+			sch: &scheduler{
+				instanceID: instanceID,
+				windows: []lib.TimeWindow{
+					{
+						StartTime: time.Date(0000, 01, 01, 7, 00, 00, 00, time.UTC),
+						StopTime:  time.Date(0000, 01, 01, 19, 00, 00, 00, time.UTC),
+						Weekdays:  []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday},
+					},
+					{
+						StartTime: time.Date(0000, 01, 01, 7, 00, 00, 00, time.UTC),
+						StopTime:  time.Date(0000, 01, 01, 15, 00, 00, 00, time.UTC),
+						Weekdays:  []time.Weekday{time.Friday},
+					},
+				},
+			},
+			dateNow: time.Date(2019, 01, 04, 00, 00, 00, 00, time.UTC), // Friday
+			timeNow: time.Date(0000, 01, 01, 16, 00, 00, 00, time.UTC),
+			want:    lib.StateStopped,
+		},
+		{
+			name: "windows with days - Thursday window",
+			sch: &scheduler{
+				instanceID: instanceID,
+				windows: []lib.TimeWindow{
+					{
+						StartTime: time.Date(0000, 01, 01, 7, 00, 00, 00, time.UTC),
+						StopTime:  time.Date(0000, 01, 01, 19, 00, 00, 00, time.UTC),
+						Weekdays:  []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday},
+					},
+					{
+						StartTime: time.Date(0000, 01, 01, 7, 00, 00, 00, time.UTC),
+						StopTime:  time.Date(0000, 01, 01, 15, 00, 00, 00, time.UTC),
+						Weekdays:  []time.Weekday{time.Friday},
+					},
+				},
+			},
+			dateNow: time.Date(2019, 01, 03, 00, 00, 00, 00, time.UTC), // Thursday
+			timeNow: time.Date(0000, 01, 01, 16, 00, 00, 00, time.UTC),
+			want:    lib.StateRunning,
+		},
+		{
+			name: "windows with days - Saturday window overrides ScheduleDay",
+			sch: &scheduler{
+				instanceID: instanceID,
+				windows: []lib.TimeWindow{
+					{
+						StartTime: time.Date(0000, 01, 01, 10, 00, 00, 00, time.UTC),
+						StopTime:  time.Date(0000, 01, 01, 14, 00, 00, 00, time.UTC),
+						Weekdays:  []time.Weekday{time.Saturday},
+					},
+				},
+			},
+			dateNow: time.Date(2019, 01, 05, 00, 00, 00, 00, time.UTC), // Saturday
+			timeNow: time.Date(0000, 01, 01, 11, 00, 00, 00, time.UTC),
+			want:    lib.StateRunning,
 		},
 	}
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			got := test.sch.shouldRun(test.dateNow, test.timeNow)
+			got, _ := test.sch.shouldRun(test.dateNow, test.timeNow)
 
 			fmt.Printf("%s\n", got)
 			assert.Equal(t, test.want, got)
@@ -173,79 +544,649 @@ func TestShouldRun(t *testing.T) {
 	}
 }
 
-func TestFixInstanceState(t *testing.T) {
+func TestLocalTime(t *testing.T) {
+	stockholm, _ := time.LoadLocation("Europe/Stockholm")
+	singapore, _ := time.LoadLocation("Asia/Singapore")
+
 	tests := []struct {
-		name   string
-		client *mockEC2client
-		sch    *scheduler
-		want   types.InstanceStateName
-		err    bool
+		name        string
+		sch         *scheduler
+		now         time.Time
+		wantWeekday time.Weekday
+		wantTime    time.Time
 	}{
 		{
-			name:   "running to running",
-			client: &mockEC2client{},
+			name: "timezone not defined - UTC",
 			sch: &scheduler{
-				instanceID:    instanceID,
-				instanceState: types.InstanceStateNameRunning,
+				instanceID: instanceID,
 			},
-			want: types.InstanceStateNameRunning,
-			err:  false,
+			now:         time.Date(2021, 03, 27, 06, 30, 00, 00, time.UTC),
+			wantWeekday: time.Saturday,
+			wantTime:    time.Date(0000, 01, 01, 6, 30, 00, 00, time.UTC),
 		},
 		{
-			name:   "stopped to running",
-			client: &mockEC2client{},
+			name: "Europe/Stockholm - standard time",
 			sch: &scheduler{
-				instanceID:    instanceID,
-				instanceState: types.InstanceStateNameStopped,
+				instanceID: instanceID,
+				location:   stockholm,
 			},
-			want: types.InstanceStateNameRunning,
-			err:  false,
+			now:         time.Date(2021, 03, 27, 06, 30, 00, 00, time.UTC),
+			wantWeekday: time.Saturday,
+			wantTime:    time.Date(0000, 01, 01, 7, 30, 00, 00, time.UTC),
 		},
 		{
-			name: "stopped to running - error",
-			client: &mockEC2client{
-				err: fmt.Errorf("error starting instance"),
+			name: "Europe/Stockholm - daylight saving time",
+			sch: &scheduler{
+				instanceID: instanceID,
+				location:   stockholm,
 			},
+			now:         time.Date(2021, 03, 28, 06, 30, 00, 00, time.UTC),
+			wantWeekday: time.Sunday,
+			wantTime:    time.Date(0000, 01, 01, 8, 30, 00, 00, time.UTC),
+		},
+		{
+			name: "Asia/Singapore - next day",
 			sch: &scheduler{
-				instanceID:    instanceID,
-				instanceState: types.InstanceStateNameStopped,
+				instanceID: instanceID,
+				location:   singapore,
 			},
-			want: types.InstanceStateNameRunning,
-			err:  true,
+			now:         time.Date(2019, 01, 06, 23, 30, 00, 00, time.UTC), // Sunday
+			wantWeekday: time.Monday,
+			wantTime:    time.Date(0000, 01, 01, 7, 30, 00, 00, time.UTC),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dateNow, timeNow := test.sch.localTime(test.now)
+
+			assert.Equal(t, test.wantWeekday, dateNow.Weekday())
+			assert.Equal(t, test.wantTime, timeNow)
+		})
+	}
+}
+
+func TestShouldRunTimezone(t *testing.T) {
+	stockholm, _ := time.LoadLocation("Europe/Stockholm")
+
+	sch := &scheduler{
+		instanceID: instanceID,
+		location:   stockholm,
+		windows: []lib.TimeWindow{
+			{
+				StartTime: time.Date(0000, 01, 01, 8, 00, 00, 00, time.UTC),
+				StopTime:  time.Date(0000, 01, 01, 19, 00, 00, 00, time.UTC),
+			},
+		},
+	}
+
+	tests := []struct {
+		name string
+		now  time.Time
+		want lib.State
+	}{
+		{
+			name: "winter - 07:30 UTC is 08:30 CET",
+			now:  time.Date(2021, 01, 11, 7, 30, 00, 00, time.UTC), // Monday
+			want: lib.StateRunning,
+		},
+		{
+			name: "summer - 06:30 UTC is 08:30 CEST",
+			now:  time.Date(2021, 06, 14, 6, 30, 00, 00, time.UTC), // Monday
+			want: lib.StateRunning,
+		},
+		{
+			name: "summer - 17:30 UTC is 19:30 CEST",
+			now:  time.Date(2021, 06, 14, 17, 30, 00, 00, time.UTC), // Monday
+			want: lib.StateStopped,
 		},
 		{
-			name:   "running to stopped",
-			client: &mockEC2client{},
+			name: "winter - 06:30 UTC is 07:30 CET",
+			now:  time.Date(2021, 01, 11, 6, 30, 00, 00, time.UTC), // Monday
+			want: lib.StateStopped,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, _ := sch.shouldRun(sch.localTime(test.now))
+
+			assert.Equal(t, test.want, got)
+		})
+	}
+}
+
+func TestShouldRunActiveDates(t *testing.T) {
+	windows := []lib.TimeWindow{
+		{
+			StartTime: time.Date(0000, 01, 01, 8, 00, 00, 00, time.UTC),
+			StopTime:  time.Date(0000, 01, 01, 19, 00, 00, 00, time.UTC),
+		},
+	}
+	activeFrom, _ := lib.ParseDate("20210301", time.UTC)
+	activeUntil, _ := lib.ParseDate("20210401T12", time.UTC)
+
+	tests := []struct {
+		name        string
+		sch         *scheduler
+		now         time.Time
+		want        lib.State
+		wantExpired bool
+	}{
+		{
+			name: "before ScheduleFrom - inert",
 			sch: &scheduler{
 				instanceID:    instanceID,
-				instanceState: types.InstanceStateNameRunning,
+				instanceState: lib.StateRunning,
+				windows:       windows,
+				activeFrom:    activeFrom,
+				activeUntil:   activeUntil,
 			},
-			want: types.InstanceStateNameStopped,
-			err:  false,
+			now:  time.Date(2021, 02, 27, 22, 00, 00, 00, time.UTC), // Saturday
+			want: lib.StateRunning,
 		},
 		{
-			name: "running to stopped - error",
-			client: &mockEC2client{
-				err: fmt.Errorf("error stopping instance"),
+			name: "between ScheduleFrom and ScheduleUntil",
+			sch: &scheduler{
+				instanceID:    instanceID,
+				instanceState: lib.StateRunning,
+				windows:       windows,
+				activeFrom:    activeFrom,
+				activeUntil:   activeUntil,
 			},
+			now:  time.Date(2021, 03, 01, 22, 00, 00, 00, time.UTC), // Monday
+			want: lib.StateStopped,
+		},
+		{
+			name: "after ScheduleUntil - stopped",
 			sch: &scheduler{
 				instanceID:    instanceID,
-				instanceState: types.InstanceStateNameRunning,
+				instanceState: lib.StateRunning,
+				windows:       windows,
+				activeFrom:    activeFrom,
+				activeUntil:   activeUntil,
 			},
-			want: types.InstanceStateNameStopped,
-			err:  true,
+			now:         time.Date(2021, 04, 01, 12, 00, 00, 00, time.UTC), // Thursday
+			want:        lib.StateStopped,
+			wantExpired: true,
 		},
 	}
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			_, err := test.sch.fixInstanceState(context.Background(), test.client, test.want)
+			dateNow, timeNow := test.sch.localTime(test.now)
+			got, _ := test.sch.shouldRun(dateNow, timeNow)
+
+			assert.Equal(t, test.want, got)
+			assert.Equal(t, test.wantExpired, test.sch.expired(dateNow))
+		})
+	}
+}
+
+func TestPlan(t *testing.T) {
+	window := []lib.TimeWindow{
+		{
+			StartTime: time.Date(0000, 01, 01, 8, 00, 00, 00, time.UTC),
+			StopTime:  time.Date(0000, 01, 01, 19, 00, 00, 00, time.UTC),
+		},
+	}
+	schedulers := []*scheduler{
+		{
+			instanceID:    "i-running",
+			instanceName:  "web-1",
+			instanceState: lib.StateStopped,
+			windows:       window,
+		},
+		{
+			instanceID:    "i-suspended",
+			instanceState: lib.StateRunning,
+			suspended:     true,
+		},
+		{
+			instanceID:    "i-weekend",
+			instanceState: lib.StateRunning,
+			windows:       window,
+			weekdays:      []time.Weekday{time.Saturday, time.Sunday},
+		},
+	}
+
+	got := plan(schedulers, time.Date(2021, 01, 11, 10, 00, 00, 00, time.UTC)) // Monday
+
+	assert.Equal(t, []planEntry{
+		{
+			InstanceID:    "i-running",
+			InstanceName:  "web-1",
+			CurrentState:  lib.StateStopped,
+			ExpectedState: lib.StateRunning,
+			Reason:        "inside time window 08:00-19:00",
+		},
+		{
+			InstanceID:    "i-suspended",
+			CurrentState:  lib.StateRunning,
+			ExpectedState: lib.StateRunning,
+			Reason:        "scheduler is suspended",
+		},
+		{
+			InstanceID:    "i-weekend",
+			CurrentState:  lib.StateRunning,
+			ExpectedState: lib.StateStopped,
+			Reason:        "should not run on Monday",
+		},
+	}, got)
+
+	// expected state is kept for fixInstancesState
+	assert.Equal(t, lib.StateRunning, schedulers[0].expectedState)
+	assert.Equal(t, lib.StateStopped, schedulers[2].expectedState)
+}
+
+func TestScheduleRegion(t *testing.T) {
+	conf := &lambdaConfig{}
+	assert.NoError(t, env.Parse(conf))
+	calendars := lib.NewCalendarStore(nil, nil, lib.CalendarConfig{})
+
+	result, events, err := scheduleRegion(context.Background(), conf, []lib.Driver{libtest.NewFakeDriver(), libtest.NewFakeDriver()}, calendars, &notifiers{}, "eu-north-1", false, time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, newHandlerResult(false), result)
+	assert.Empty(t, events)
+
+	// a driver failing alone is skipped, its error reported with the region
+	rdsDriver := libtest.NewFakeDriver(lib.Resource{Type: lib.ResourceTypeDBInstance, ID: "db"})
+	rdsDriver.Err = fmt.Errorf("AccessDenied")
+	result, _, err = scheduleRegion(context.Background(), conf, []lib.Driver{libtest.NewFakeDriver(), rdsDriver}, calendars, &notifiers{}, "eu-north-1", false, time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"eu-north-1/dbInstance": "AccessDenied"}, result.RegionErrors)
+
+	// region errors are returned, for the handler to isolate them
+	_, _, err = scheduleRegion(context.Background(), conf, []lib.Driver{&libtest.FakeDriver{Err: fmt.Errorf("AuthFailure")}}, calendars, &notifiers{}, "eu-north-1", false, time.Now())
+	assert.EqualError(t, err, "AuthFailure")
+}
+
+func TestScheduleRegionReservation(t *testing.T) {
+	conf := &lambdaConfig{}
+	assert.NoError(t, env.Parse(conf))
+	now := time.Date(2021, 01, 11, 10, 00, 00, 00, time.UTC) // Monday
+
+	// instances launched together share a reservation, every one of them is scheduled
+	reservation := types.Reservation{OwnerId: aws.String("123456789012")}
+	for _, id := range []string{"i-1", "i-2", "i-3"} {
+		reservation.Instances = append(reservation.Instances, types.Instance{
+			InstanceId: aws.String(id),
+			State:      &types.InstanceState{Name: types.InstanceStateNameStopped},
+			Tags:       []types.Tag{{Key: aws.String("Schedule"), Value: aws.String("07:00-19:00")}},
+		})
+	}
+	client := &mockEC2client{reservations: []types.Reservation{reservation}}
+
+	result, _, err := scheduleRegion(context.Background(), conf, []lib.Driver{lib.NewEC2Driver(client, "eu-west-1")}, lib.NewCalendarStore(nil, nil, lib.CalendarConfig{}), &notifiers{}, "eu-west-1", false, now)
+	assert.NoError(t, err)
+	assert.Len(t, result.Plan, 3)
+	assert.Equal(t, 3, result.Started)
+	assert.Equal(t, [][]string{{"i-1", "i-2", "i-3"}}, client.started)
+}
+
+func TestScheduleRegionTypes(t *testing.T) {
+	conf := &lambdaConfig{}
+	assert.NoError(t, env.Parse(conf))
+	now := time.Date(2021, 01, 11, 10, 00, 00, 00, time.UTC) // Monday
+
+	group := lib.Resource{Type: lib.ResourceTypeAutoScalingGroup, ID: "web", Name: "web", Region: "eu-west-1", State: lib.StateStopped, Tags: map[string]string{"Schedule": "07:00-19:00"}}
+	member := lib.Resource{Type: lib.ResourceTypeInstance, ID: "i-1", Region: "eu-west-1", State: lib.StateStopped, Tags: map[string]string{"Schedule": "07:00-19:00", lib.AutoScalingGroupTag: "web"}}
+	service := lib.Resource{Type: lib.ResourceTypeECSService, ID: "apps/api", Name: "api", Region: "eu-west-1", State: lib.StateStopped, Tags: map[string]string{"Schedule": "#07:00-19:00", "ScheduleSuspendUntil": "20210111T08:00"}}
+	instance := lib.Resource{Type: lib.ResourceTypeInstance, ID: "i-2", Region: "eu-west-1", State: lib.StateRunning, Tags: map[string]string{"Schedule": "07:00-19:00"}}
+
+	ec2Driver := libtest.NewFakeDriver(member, instance)
+	asgDriver := libtest.NewFakeDriver(group)
+	ecsDriver := libtest.NewFakeDriver(service)
+
+	result, events, err := scheduleRegion(context.Background(), conf, []lib.Driver{ec2Driver, asgDriver, ecsDriver}, lib.NewCalendarStore(nil, nil, lib.CalendarConfig{}), &notifiers{}, "eu-west-1", false, now)
+	assert.NoError(t, err)
+	assert.Len(t, result.Plan, 4)
+	assert.Equal(t, 2, result.Started)
+
+	// the member is scheduled with its group, the expired suspension of the service is lifted
+	assert.Empty(t, ec2Driver.Started)
+	assert.Equal(t, []string{"web"}, asgDriver.Started)
+	assert.Equal(t, []string{"apps/api"}, ecsDriver.Started)
+	assert.Equal(t, map[string]string{"Schedule": "07:00-19:00"}, ecsDriver.Tags("apps/api"))
+	assert.Len(t, events, 3)
+}
+
+func TestScheduleAccount(t *testing.T) {
+	conf := &lambdaConfig{}
+	assert.NoError(t, env.Parse(conf))
+	calendars := lib.NewCalendarStore(nil, nil, lib.CalendarConfig{})
+	now := time.Date(2021, 01, 11, 10, 00, 00, 00, time.UTC) // Monday
+
+	// drivers of the assumed role, a region is denied by an SCP
+	instance := lib.Resource{Type: lib.ResourceTypeInstance, ID: "i-1", Account: "111111111111", Region: "eu-west-1", State: lib.StateStopped, Tags: map[string]string{"Schedule": "07:00-19:00"}}
+	drivers := map[string]*libtest.FakeDriver{
+		"eu-west-1":  libtest.NewFakeDriver(instance),
+		"eu-north-1": {Err: fmt.Errorf("UnauthorizedOperation")},
+	}
+	newDrivers := func(region string) []lib.Driver {
+		return []lib.Driver{drivers[region]}
+	}
+
+	result, events, err := scheduleAccount(context.Background(), conf, newDrivers, []string{"eu-west-1", "eu-north-1"}, calendars, &notifiers{}, false, now)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, result.Started)
+	assert.Equal(t, "111111111111", result.Plan[0].Account)
+	assert.Equal(t, "eu-west-1", result.Plan[0].Region)
+	assert.Equal(t, []string{"i-1"}, drivers["eu-west-1"].Started)
+	assert.Equal(t, map[string]string{"eu-north-1": "UnauthorizedOperation"}, result.RegionErrors)
+	assert.Len(t, events, 1)
+	assert.Equal(t, "111111111111", events[0].Detail.Account)
+
+	// no region at all, the account fails
+	_, _, err = scheduleAccount(context.Background(), conf, newDrivers, []string{"eu-north-1"}, calendars, &notifiers{}, false, now)
+	assert.EqualError(t, err, "UnauthorizedOperation")
+}
+
+func TestHandlerResultMergeAccount(t *testing.T) {
+	result := newHandlerResult(false)
+	result.mergeAccount("111111111111", &handlerResult{
+		Started:      2,
+		Failures:     []failure{{Account: "111111111111", InstanceID: "i-1"}},
+		RegionErrors: map[string]string{"eu-north-1": "UnauthorizedOperation"},
+	})
+	result.mergeAccount("222222222222", &handlerResult{Stopped: 1})
+
+	assert.Equal(t, 2, result.Started)
+	assert.Equal(t, 1, result.Stopped)
+	assert.Len(t, result.Failures, 1)
+	assert.Equal(t, map[string]string{"111111111111/eu-north-1": "UnauthorizedOperation"}, result.RegionErrors)
+	assert.Equal(t, map[string]accountSummary{
+		"111111111111": {Started: 2, Failed: 1},
+		"222222222222": {Stopped: 1},
+	}, result.Accounts)
+
+	// Lambda account, no summary
+	result = newHandlerResult(false)
+	result.mergeAccount("", &handlerResult{Started: 1, RegionErrors: map[string]string{"eu-north-1": "UnauthorizedOperation"}})
+	assert.Equal(t, map[string]string{"eu-north-1": "UnauthorizedOperation"}, result.RegionErrors)
+	assert.Empty(t, result.Accounts)
+}
+
+func TestHandlerResultMerge(t *testing.T) {
+	result := newHandlerResult(false)
+	result.merge(&handlerResult{Plan: []planEntry{{Region: "eu-west-1", InstanceID: "i-1"}}, Started: 1})
+	result.merge(&handlerResult{Plan: []planEntry{{Region: "eu-north-1", InstanceID: "i-2"}}, Stopped: 2, Failures: []failure{{Region: "eu-north-1", InstanceID: "i-3"}}})
+
+	assert.Len(t, result.Plan, 2)
+	assert.Equal(t, 1, result.Started)
+	assert.Equal(t, 2, result.Stopped)
+	assert.Equal(t, []failure{{Region: "eu-north-1", InstanceID: "i-3"}}, result.Failures)
+}
+
+func TestDisableSchedule(t *testing.T) {
+	conf := &lambdaConfig{}
+	assert.NoError(t, env.Parse(conf))
+
+	r := lib.Resource{Type: lib.ResourceTypeInstance, ID: instanceID, Region: "eu-west-1", State: lib.StateStopped, Tags: map[string]string{"Schedule": "07:00-19:00"}}
+	driver := libtest.NewFakeDriver(r)
+	sch := &scheduler{
+		instanceID:  instanceID,
+		resource:    r,
+		driver:      driver,
+		schedule:    "07:00-19:00",
+		activeUntil: time.Date(2021, 04, 01, 12, 00, 00, 00, time.UTC),
+	}
+
+	err := sch.disableSchedule(context.Background(), conf)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"Schedule":               "#07:00-19:00",
+		"ScheduleDisabledBy":     "ec2scheduler",
+		"ScheduleDisabledReason": "ScheduleUntil 2021-04-01 12:00 expired",
+	}, driver.Tags(instanceID))
+
+	sch.driver = &libtest.FakeDriver{Err: fmt.Errorf("error creating tags")}
+	err = sch.disableSchedule(context.Background(), conf)
+	assert.Error(t, err)
+}
+
+func TestUnsuspend(t *testing.T) {
+	conf := &lambdaConfig{}
+	assert.NoError(t, env.Parse(conf))
+
+	r := lib.Resource{Type: lib.ResourceTypeInstance, ID: instanceID, Region: "eu-west-1", State: lib.StateStopped, Tags: map[string]string{
+		"Schedule":             "#07:00-19:00",
+		"ScheduleSuspendUntil": "20210111T08:00",
+		"ScheduleSuspendMode":  "keep-stopped",
+	}}
+	driver := libtest.NewFakeDriver(r)
+	sch := &scheduler{
+		instanceID:  instanceID,
+		resource:    r,
+		driver:      driver,
+		schedule:    "#07:00-19:00",
+		suspended:   true,
+		suspendMode: lib.SuspendModeStopped,
+	}
+
+	err := sch.unsuspend(context.Background(), conf)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"Schedule": "07:00-19:00"}, driver.Tags(instanceID))
+	assert.False(t, sch.suspended)
+	assert.Equal(t, "", sch.suspendMode)
+
+	sch = &scheduler{instanceID: instanceID, resource: r, driver: &libtest.FakeDriver{Err: fmt.Errorf("error deleting tags")}, schedule: "#07:00-19:00", suspended: true}
+	err = sch.unsuspend(context.Background(), conf)
+	assert.Error(t, err)
+	assert.True(t, sch.suspended)
+}
+
+func TestChangeStates(t *testing.T) {
+	conf := &lambdaConfig{}
+	assert.NoError(t, env.Parse(conf))
+
+	tests := []struct {
+		name     string
+		driver   *libtest.FakeDriver
+		state    lib.State
+		expected lib.State
+		want     stateChange
+		err      bool
+	}{
+		{
+			name:     "running to running",
+			driver:   libtest.NewFakeDriver(),
+			state:    lib.StateRunning,
+			expected: lib.StateRunning,
+			want:     stateChange{},
+		},
+		{
+			name:     "stopped to running",
+			driver:   libtest.NewFakeDriver(),
+			state:    lib.StateStopped,
+			expected: lib.StateRunning,
+			want:     stateChange{state: lib.StateRunning},
+		},
+		{
+			name:     "stopped to running - error",
+			driver:   &libtest.FakeDriver{Err: fmt.Errorf("error starting instance")},
+			state:    lib.StateStopped,
+			expected: lib.StateRunning,
+			err:      true,
+		},
+		{
+			name:     "running to stopped",
+			driver:   libtest.NewFakeDriver(),
+			state:    lib.StateRunning,
+			expected: lib.StateStopped,
+			want:     stateChange{state: lib.StateStopped},
+		},
+		{
+			name:     "running to stopped - error",
+			driver:   &libtest.FakeDriver{Err: fmt.Errorf("error stopping instance")},
+			state:    lib.StateRunning,
+			expected: lib.StateStopped,
+			err:      true,
+		},
+		{
+			name:     "stopped to running - nothing to restore",
+			driver:   &libtest.FakeDriver{Fail: map[string]error{instanceID: lib.ErrUnchanged}},
+			state:    lib.StateStopped,
+			expected: lib.StateRunning,
+			want:     stateChange{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := lib.Resource{Type: lib.ResourceTypeInstance, ID: instanceID, Region: "eu-west-1", State: test.state, Tags: map[string]string{"Schedule": "07:00-19:00"}}
+			test.driver.Resources = append(test.driver.Resources, r)
+			sch := &scheduler{
+				instanceID:    instanceID,
+				instanceState: test.state,
+				expectedState: test.expected,
+				resource:      r,
+				driver:        test.driver,
+			}
+
+			changes := changeStates(context.Background(), conf, []*scheduler{sch})
 			if test.err {
-				assert.Error(t, err)
+				assert.Error(t, changes[sch].err)
 				return
 			}
 
-			assert.NoError(t, err)
+			assert.Equal(t, test.want, changes[sch])
 		})
 	}
 }
+
+func TestChangeStatesDrivers(t *testing.T) {
+	conf := &lambdaConfig{}
+	assert.NoError(t, env.Parse(conf))
+
+	db := lib.Resource{Type: lib.ResourceTypeDBInstance, ID: "orders", State: lib.StateRunning, Tags: map[string]string{"Schedule": "07:00-19:00", "ScheduleStoppedAt": "2021-01-08T19:00:00Z"}}
+	ec2Driver := &libtest.FakeDriver{Fail: map[string]error{"i-2": fmt.Errorf("IncorrectInstanceState")}}
+	rdsDriver := libtest.NewFakeDriver(db)
+
+	schedulers := []*scheduler{
+		{instanceID: "i-1", instanceState: lib.StateRunning, expectedState: lib.StateStopped, driver: ec2Driver},
+		{instanceID: "i-2", instanceState: lib.StateRunning, expectedState: lib.StateStopped, driver: ec2Driver},
+		{instanceID: "i-3", instanceState: lib.StateStopped, expectedState: lib.StateRunning, driver: ec2Driver},
+		{instanceID: "i-4", instanceState: lib.StateStopped, expectedState: lib.StateRunning, driver: ec2Driver, autoScalingGroup: "web"},
+		// started by hand since the scheduler stopped it
+		{instanceID: "orders", instanceState: lib.StateRunning, expectedState: lib.StateRunning, driver: rdsDriver, resource: db, stoppedAt: time.Date(2021, 01, 8, 19, 00, 00, 00, time.UTC)},
+	}
+	for _, s := range schedulers[:4] {
+		s.resource = lib.Resource{Type: lib.ResourceTypeInstance, ID: s.instanceID}
+	}
+
+	changes := changeStates(context.Background(), conf, schedulers)
+
+	// one Stop call for the driver, a failing resource doesn't affect the others
+	assert.Equal(t, []string{"i-1"}, ec2Driver.Stopped)
+	assert.Equal(t, []string{"i-3"}, ec2Driver.Started)
+	assert.Equal(t, stateChange{state: lib.StateStopped}, changes[schedulers[0]])
+	assert.Error(t, changes[schedulers[1]].err)
+	assert.Equal(t, stateChange{state: lib.StateRunning}, changes[schedulers[2]])
+	assert.Equal(t, stateChange{}, changes[schedulers[3]])
+	assert.Equal(t, stateChange{}, changes[schedulers[4]])
+	assert.Equal(t, map[string]string{"Schedule": "07:00-19:00"}, rdsDriver.Tags("orders"))
+}
+
+func TestShouldRunHoliday(t *testing.T) {
+	sch := &scheduler{
+		instanceID: instanceID,
+		calendar:   lib.ParseCalendar("2021-12-24 Christmas Eve"),
+		windows: []lib.TimeWindow{
+			{
+				StartTime: time.Date(0000, 01, 01, 8, 00, 00, 00, time.UTC),
+				StopTime:  time.Date(0000, 01, 01, 19, 00, 00, 00, time.UTC),
+			},
+		},
+	}
+
+	got, _ := sch.shouldRun(sch.localTime(time.Date(2021, 12, 24, 10, 00, 00, 00, time.UTC))) // Friday
+	assert.Equal(t, lib.StateStopped, got)
+
+	got, _ = sch.shouldRun(sch.localTime(time.Date(2021, 12, 23, 10, 00, 00, 00, time.UTC))) // Thursday
+	assert.Equal(t, lib.StateRunning, got)
+}
+
+func TestNextStop(t *testing.T) {
+	_, stop, _ := lib.ParseCronSchedule("stop=0 19 * * *")
+	sch := &scheduler{
+		instanceID:    instanceID,
+		instanceState: lib.StateRunning,
+		windows: []lib.TimeWindow{
+			{
+				StartTime: time.Date(0000, 01, 01, 8, 00, 00, 00, time.UTC),
+				StopTime:  time.Date(0000, 01, 01, 19, 00, 00, 00, time.UTC),
+			},
+		},
+		warn: 15 * time.Minute,
+	}
+
+	got, ok := sch.nextStop(time.Date(2021, 01, 11, 18, 50, 30, 00, time.UTC)) // Monday
+	assert.True(t, ok)
+	assert.Equal(t, time.Date(2021, 01, 11, 19, 00, 00, 00, time.UTC), got)
+
+	_, ok = sch.nextStop(time.Date(2021, 01, 11, 18, 30, 00, 00, time.UTC))
+	assert.False(t, ok)
+
+	// cron stop
+	sch = &scheduler{
+		instanceID:    instanceID,
+		instanceState: lib.StateRunning,
+		cronStop:      stop,
+		interval:      5 * time.Minute,
+		warn:          15 * time.Minute,
+	}
+	got, ok = sch.nextStop(time.Date(2021, 01, 11, 18, 47, 00, 00, time.UTC))
+	assert.True(t, ok)
+	assert.Equal(t, time.Date(2021, 01, 11, 19, 00, 00, 00, time.UTC), got)
+}
+
+func TestWarnStop(t *testing.T) {
+	conf := &lambdaConfig{}
+	assert.NoError(t, env.Parse(conf))
+
+	stockholm, _ := time.LoadLocation("Europe/Stockholm")
+	r := lib.Resource{Type: lib.ResourceTypeInstance, ID: instanceID, Name: "web-1", Region: "eu-west-1", State: lib.StateStopped, Tags: map[string]string{"Schedule": "08:00-19:00"}}
+	driver := libtest.NewFakeDriver(r)
+	snsClient := &mockSNSclient{}
+	sch := &scheduler{
+		instanceID:    instanceID,
+		resource:      r,
+		driver:        driver,
+		instanceName:  "web-1",
+		instanceState: lib.StateRunning,
+		location:      stockholm,
+		windows: []lib.TimeWindow{
+			{
+				StartTime: time.Date(0000, 01, 01, 8, 00, 00, 00, time.UTC),
+				StopTime:  time.Date(0000, 01, 01, 19, 00, 00, 00, time.UTC),
+			},
+		},
+		notifyTargets: []string{"arn:aws:sns:eu-west-1:123456789012:my-topic"},
+		warn:          15 * time.Minute,
+	}
+
+	// 18:50 in Stockholm
+	now := time.Date(2021, 01, 11, 17, 50, 00, 00, time.UTC)
+	assert.NoError(t, sch.warnStop(context.Background(), &notifiers{sns: snsClient}, conf, now))
+	assert.Len(t, snsClient.inputs, 1)
+	assert.Equal(t, "i-07d023c826d243165 (web-1) will stop in 10 minutes, at 19:00 CET. Suspend the scheduler to postpone", aws.ToString(snsClient.inputs[0].Subject))
+	assert.Equal(t, "stop-warning", aws.ToString(snsClient.inputs[0].MessageAttributes["event"].StringValue))
+	assert.Contains(t, aws.ToString(snsClient.inputs[0].Message), `"stopAt":"2021-01-11T18:00:00Z"`)
+	assert.Equal(t, "20210111T19:00", driver.Tags(instanceID)["ScheduleWarnedStop"])
+
+	// warned only once
+	assert.NoError(t, sch.warnStop(context.Background(), &notifiers{sns: snsClient}, conf, now.Add(5*time.Minute)))
+	assert.Len(t, snsClient.inputs, 1)
+
+	// no warning configured
+	sch.warn = 0
+	sch.warnedStop = ""
+	assert.NoError(t, sch.warnStop(context.Background(), &notifiers{sns: snsClient}, conf, now))
+	assert.Len(t, snsClient.inputs, 1)
+
+	sch.warn = 15 * time.Minute
+	err := sch.warnStop(context.Background(), &notifiers{sns: &mockSNSclient{err: fmt.Errorf("error publishing")}}, conf, now)
+	assert.Error(t, err)
+	assert.Equal(t, "", sch.warnedStop)
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+)
+
+// header of the HMAC-SHA256 signature of generic webhook requests
+const signatureHeader = "X-Ec2scheduler-Signature"
+
+// notifier delivers notifications to a target of scheduleTagSNS
+type notifier interface {
+	notify(ctx context.Context, n notification) error
+}
+
+// notifiers builds the notifier of a target from its scheme: arn:aws:sns:... SNS topic,
+// slack://... Slack incoming webhook, teams://... Microsoft Teams incoming webhook (Adaptive Card),
+// https://... generic webhook, the notification JSON signed with webhookSecret
+type notifiers struct {
+	sns  snsClientAPI
+	http *http.Client
+	// HMAC-SHA256 key of generic webhooks, requests are not signed if empty
+	webhookSecret string
+}
+
+func (f *notifiers) get(target string) (notifier, error) {
+	switch {
+	case strings.HasPrefix(target, "arn:"):
+		return &snsNotifier{client: f.sns, topicArn: target}, nil
+	case strings.HasPrefix(target, "slack://"):
+		return &slackNotifier{client: f.http, url: "https://" + strings.TrimPrefix(target, "slack://")}, nil
+	case strings.HasPrefix(target, "teams://"):
+		return &teamsNotifier{client: f.http, url: "https://" + strings.TrimPrefix(target, "teams://")}, nil
+	case strings.HasPrefix(target, "https://"):
+		return &webhookNotifier{client: f.http, url: target, secret: f.webhookSecret}, nil
+	case strings.HasPrefix(target, "http://"):
+		// the notification and its signature would go in clear text
+		return nil, fmt.Errorf("webhook %s must use https", redactTarget(target))
+	}
+
+	return nil, fmt.Errorf("unknown notification target %s", redactTarget(target))
+}
+
+// deliver the notification to every target
+// every target is tried, the first error is returned
+func (f *notifiers) send(ctx context.Context, targets []string, n notification) error {
+	var firstErr error
+	for _, target := range targets {
+		err := func() error {
+			notifier, err := f.get(target)
+			if err != nil {
+				return err
+			}
+			return notifier.notify(ctx, n)
+		}()
+		if err != nil {
+			log.Printf("[%s] unable to notify %s: %s", n.logID(), redactTarget(target), err)
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+
+		log.Printf("[%s] %s notification sent to %s", n.logID(), n.Event, redactTarget(target))
+	}
+
+	return firstErr
+}
+
+// notification targets of scheduleTagSNS, comma separated
+func parseNotifyTargets(value string) []string {
+	targets := []string{}
+	for _, target := range strings.Split(value, ",") {
+		if target = strings.TrimSpace(target); target != "" {
+			targets = append(targets, target)
+		}
+	}
+
+	return targets
+}
+
+// target without the webhook path, which holds its secret token: fit for logs
+func redactTarget(target string) string {
+	if strings.HasPrefix(target, "arn:") {
+		return target
+	}
+
+	u, err := url.Parse(target)
+	if err != nil || u.Host == "" {
+		return "webhook"
+	}
+	return u.Scheme + "://" + u.Host
+}
+
+// SNS client publishing in the region of the topic
+// topics can be anywhere, whatever the region of the instances
+type regionalSNSClient struct {
+	cfg     aws.Config
+	mu      sync.Mutex
+	clients map[string]*sns.Client
+}
+
+func newRegionalSNSClient(cfg aws.Config) *regionalSNSClient {
+	return &regionalSNSClient{cfg: cfg, clients: map[string]*sns.Client{}}
+}
+
+func (c *regionalSNSClient) Publish(ctx context.Context, params *sns.PublishInput, optFns ...func(*sns.Options)) (*sns.PublishOutput, error) {
+	return c.client(topicRegion(aws.ToString(params.TopicArn))).Publish(ctx, params, optFns...)
+}
+
+func (c *regionalSNSClient) client(region string) *sns.Client {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if region == "" {
+		region = c.cfg.Region
+	}
+	if _, ok := c.clients[region]; !ok {
+		c.clients[region] = sns.NewFromConfig(c.cfg, func(o *sns.Options) {
+			o.Region = region
+		})
+	}
+
+	return c.clients[region]
+}
+
+// region of an SNS topic arn: arn:aws:sns:<region>:<account>:<topic>
+func topicRegion(topicArn string) string {
+	parts := strings.Split(topicArn, ":")
+	if len(parts) < 6 {
+		return ""
+	}
+
+	return parts[3]
+}
+
+type snsNotifier struct {
+	client   snsClientAPI
+	topicArn string
+}
+
+func (n *snsNotifier) notify(ctx context.Context, notification notification) error {
+	message, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+
+	_, err = n.client.Publish(ctx, &sns.PublishInput{
+		Message:           aws.String(string(message)),
+		Subject:           aws.String(subject(notification.Subject)),
+		MessageAttributes: notification.attributes(),
+		TopicArn:          aws.String(n.topicArn),
+	})
+	return err
+}
+
+type slackNotifier struct {
+	client *http.Client
+	url    string
+}
+
+func (n *slackNotifier) notify(ctx context.Context, notification notification) error {
+	body, err := json.Marshal(map[string]string{
+		"text": fmt.Sprintf("%s\n%s", notification.Subject, notification.Reason),
+	})
+	if err != nil {
+		return err
+	}
+
+	return post(ctx, n.client, n.url, body, nil)
+}
+
+type teamsNotifier struct {
+	client *http.Client
+	url    string
+}
+
+// Adaptive Card in a message, the format of Teams incoming webhooks
+func (n *teamsNotifier) notify(ctx context.Context, notification notification) error {
+	facts := []map[string]string{
+		{"title": "Instance", "value": fmt.Sprintf("%s (%s)", notification.InstanceID, notification.InstanceName)},
+		{"title": "State", "value": fmt.Sprintf("%s -> %s", notification.PreviousState, notification.State)},
+		{"title": "Reason", "value": notification.Reason},
+		{"title": "Schedule", "value": notification.Schedule},
+	}
+	if notification.Environment != "" {
+		facts = append(facts, map[string]string{"title": "Environment", "value": notification.Environment})
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"type": "message",
+		"attachments": []map[string]interface{}{
+			{
+				"contentType": "application/vnd.microsoft.card.adaptive",
+				"content": map[string]interface{}{
+					"$schema": "http://adaptivecards.io/schemas/adaptive-card.json",
+					"type":    "AdaptiveCard",
+					"version": "1.2",
+					"body": []map[string]interface{}{
+						{"type": "TextBlock", "text": notification.Subject, "weight": "bolder", "wrap": true},
+						{"type": "FactSet", "facts": facts},
+					},
+				},
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	return post(ctx, n.client, n.url, body, nil)
+}
+
+type webhookNotifier struct {
+	client *http.Client
+	url    string
+	secret string
+}
+
+// the notification JSON, its HMAC-SHA256 (hex) in signatureHeader: sha256=...
+func (n *webhookNotifier) notify(ctx context.Context, notification notification) error {
+	body, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+
+	headers := map[string]string{}
+	if n.secret != "" {
+		mac := hmac.New(sha256.New, []byte(n.secret))
+		mac.Write(body)
+		headers[signatureHeader] = "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	}
+
+	return post(ctx, n.client, n.url, body, headers)
+}
+
+// POST the JSON body to url, any status but 2xx is an error
+func post(ctx context.Context, client *http.Client, webhookURL string, body []byte, headers map[string]string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	// leave the URL, and its secret token, out of the error
+	resp, err := client.Do(req)
+	if urlErr, ok := err.(*url.Error); ok {
+		return urlErr.Err
+	}
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		log.Printf("webhook response: %s", msg)
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+
+	return nil
+}
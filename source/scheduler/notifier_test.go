@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dwtechnologies/ec2scheduler/source/lib"
+	"github.com/stretchr/testify/assert"
+)
+
+// webhook server recording the requests, answering status
+type webhookServer struct {
+	*httptest.Server
+	status  int
+	bodies  [][]byte
+	headers []http.Header
+}
+
+func newWebhookServer(t *testing.T, status int) *webhookServer {
+	w := &webhookServer{status: status}
+	w.Server = httptest.NewTLSServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		assert.NoError(t, err)
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+
+		w.bodies = append(w.bodies, body)
+		w.headers = append(w.headers, r.Header)
+		rw.WriteHeader(w.status)
+	}))
+	t.Cleanup(w.Close)
+
+	return w
+}
+
+func testNotification() notification {
+	return notification{
+		Version:       notificationVersion,
+		Event:         eventStateChange,
+		InstanceID:    instanceID,
+		InstanceName:  "web-1",
+		PreviousState: lib.StateRunning,
+		State:         lib.StateStopped,
+		Reason:        "outside time windows",
+		Schedule:      "07:00-19:00",
+		Timestamp:     time.Date(2021, 01, 11, 19, 02, 00, 00, time.UTC),
+		Environment:   "prod",
+		Subject:       "i-07d023c826d243165 (web-1) state changed to stopped",
+	}
+}
+
+func TestNotifiersGet(t *testing.T) {
+	notifiers := &notifiers{sns: &mockSNSclient{}, http: http.DefaultClient, webhookSecret: "secret"}
+
+	tests := []struct {
+		target string
+		want   notifier
+		err    bool
+	}{
+		{
+			target: "arn:aws:sns:eu-west-1:123456789012:my-topic",
+			want:   &snsNotifier{client: notifiers.sns, topicArn: "arn:aws:sns:eu-west-1:123456789012:my-topic"},
+		},
+		{
+			target: "slack://hooks.slack.com/services/T000/B000/XXXX",
+			want:   &slackNotifier{client: http.DefaultClient, url: "https://hooks.slack.com/services/T000/B000/XXXX"},
+		},
+		{
+			target: "teams://example.webhook.office.com/webhookb2/XXXX",
+			want:   &teamsNotifier{client: http.DefaultClient, url: "https://example.webhook.office.com/webhookb2/XXXX"},
+		},
+		{
+			target: "https://example.com/ec2scheduler",
+			want:   &webhookNotifier{client: http.DefaultClient, url: "https://example.com/ec2scheduler", secret: "secret"},
+		},
+		{
+			target: "mailto:ops@example.com",
+			err:    true,
+		},
+		{
+			target: "http://example.com/ec2scheduler",
+			err:    true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.target, func(t *testing.T) {
+			got, err := notifiers.get(test.target)
+			if test.err {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, test.want, got)
+		})
+	}
+}
+
+func TestParseNotifyTargets(t *testing.T) {
+	assert.Equal(t, []string{"arn:aws:sns:eu-west-1:123456789012:my-topic"}, parseNotifyTargets("arn:aws:sns:eu-west-1:123456789012:my-topic"))
+	assert.Equal(t, []string{"arn:aws:sns:eu-west-1:123456789012:my-topic", "slack://hooks.slack.com/services/T000/B000/XXXX"},
+		parseNotifyTargets("arn:aws:sns:eu-west-1:123456789012:my-topic, slack://hooks.slack.com/services/T000/B000/XXXX,"))
+	assert.Equal(t, []string{}, parseNotifyTargets(""))
+}
+
+func TestRedactTarget(t *testing.T) {
+	assert.Equal(t, "arn:aws:sns:eu-west-1:123456789012:my-topic", redactTarget("arn:aws:sns:eu-west-1:123456789012:my-topic"))
+	assert.Equal(t, "slack://hooks.slack.com", redactTarget("slack://hooks.slack.com/services/T000/B000/XXXX"))
+	assert.Equal(t, "webhook", redactTarget("not a url"))
+}
+
+func TestTopicRegion(t *testing.T) {
+	assert.Equal(t, "eu-north-1", topicRegion("arn:aws:sns:eu-north-1:123456789012:my-topic"))
+	assert.Equal(t, "", topicRegion("my-topic"))
+}
+
+func TestSlackNotifier(t *testing.T) {
+	server := newWebhookServer(t, http.StatusOK)
+
+	err := (&slackNotifier{client: server.Client(), url: server.URL}).notify(context.Background(), testNotification())
+	assert.NoError(t, err)
+	assert.Len(t, server.bodies, 1)
+	assert.JSONEq(t, `{"text": "i-07d023c826d243165 (web-1) state changed to stopped\noutside time windows"}`, string(server.bodies[0]))
+}
+
+func TestTeamsNotifier(t *testing.T) {
+	server := newWebhookServer(t, http.StatusOK)
+
+	err := (&teamsNotifier{client: server.Client(), url: server.URL}).notify(context.Background(), testNotification())
+	assert.NoError(t, err)
+	assert.Len(t, server.bodies, 1)
+
+	var message struct {
+		Type        string `json:"type"`
+		Attachments []struct {
+			ContentType string `json:"contentType"`
+			Content     struct {
+				Type string `json:"type"`
+				Body []struct {
+					Type  string `json:"type"`
+					Text  string `json:"text"`
+					Facts []struct {
+						Title string `json:"title"`
+						Value string `json:"value"`
+					} `json:"facts"`
+				} `json:"body"`
+			} `json:"content"`
+		} `json:"attachments"`
+	}
+	assert.NoError(t, json.Unmarshal(server.bodies[0], &message))
+	assert.Equal(t, "message", message.Type)
+	assert.Equal(t, "application/vnd.microsoft.card.adaptive", message.Attachments[0].ContentType)
+
+	card := message.Attachments[0].Content
+	assert.Equal(t, "AdaptiveCard", card.Type)
+	assert.Equal(t, "i-07d023c826d243165 (web-1) state changed to stopped", card.Body[0].Text)
+	assert.Equal(t, "State", card.Body[1].Facts[1].Title)
+	assert.Equal(t, "running -> stopped", card.Body[1].Facts[1].Value)
+	assert.Equal(t, "prod", card.Body[1].Facts[4].Value)
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	server := newWebhookServer(t, http.StatusNoContent)
+
+	err := (&webhookNotifier{client: server.Client(), url: server.URL, secret: "secret"}).notify(context.Background(), testNotification())
+	assert.NoError(t, err)
+	assert.Len(t, server.bodies, 1)
+	assert.Contains(t, string(server.bodies[0]), `"event":"state-change"`)
+
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write(server.bodies[0])
+	assert.Equal(t, "sha256="+hex.EncodeToString(mac.Sum(nil)), server.headers[0].Get(signatureHeader))
+
+	// not signed without secret
+	err = (&webhookNotifier{client: server.Client(), url: server.URL}).notify(context.Background(), testNotification())
+	assert.NoError(t, err)
+	assert.Equal(t, "", server.headers[1].Get(signatureHeader))
+}
+
+func TestWebhookNotifierErrors(t *testing.T) {
+	server := newWebhookServer(t, http.StatusForbidden)
+
+	err := (&webhookNotifier{client: server.Client(), url: server.URL}).notify(context.Background(), testNotification())
+	assert.EqualError(t, err, "webhook returned 403 Forbidden")
+
+	// the URL, with its token, is left out of connection errors
+	server.Close()
+	err = (&slackNotifier{client: server.Client(), url: server.URL + "/services/T000/B000/XXXX"}).notify(context.Background(), testNotification())
+	assert.Error(t, err)
+	assert.NotContains(t, err.Error(), "XXXX")
+}
+
+func TestSchedulerNotify(t *testing.T) {
+	server := newWebhookServer(t, http.StatusOK)
+	snsClient := &mockSNSclient{}
+	sch := &scheduler{
+		instanceID:    instanceID,
+		notifyTargets: []string{"mailto:ops@example.com", "arn:aws:sns:eu-west-1:123456789012:my-topic", server.URL},
+	}
+
+	// every target is notified, despite the first one failing
+	err := sch.notify(context.Background(), &notifiers{sns: snsClient, http: server.Client()}, testNotification())
+	assert.Error(t, err)
+	assert.Len(t, snsClient.inputs, 1)
+	assert.Len(t, server.bodies, 1)
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	snstypes "github.com/aws/aws-sdk-go-v2/service/sns/types"
+	"github.com/dwtechnologies/ec2scheduler/source/lib"
+)
+
+// version of the notification payload, bumped on breaking changes
+const notificationVersion = "1"
+
+// notification events
+const (
+	eventStateChange = "state-change"
+	eventStopWarning = "stop-warning"
+	// start/stop failed, see failure
+	eventStateChangeFailed = "state-change-failed"
+)
+
+// SNS subjects are limited to 100 ASCII characters
+const maxSubjectLength = 100
+
+// notification sent to the ScheduleSNS targets, as JSON to SNS topics and generic webhooks
+// event, state, previousState, account, region, environment and errorClass are also sent as message attributes,
+// so that subscriptions can filter on them
+type notification struct {
+	Version       string    `json:"version"`
+	Event         string    `json:"event"`
+	InstanceID    string    `json:"instanceId"`
+	InstanceName  string    `json:"instanceName,omitempty"`
+	PreviousState lib.State `json:"previousState"`
+	State         lib.State `json:"state"`
+	Reason        string    `json:"reason"`
+	Schedule      string    `json:"schedule"`
+	// stop-warning, when the instance will be stopped
+	StopAt      *time.Time `json:"stopAt,omitempty"`
+	Timestamp   time.Time  `json:"timestamp"`
+	Account     string     `json:"account,omitempty"`
+	Region      string     `json:"region,omitempty"`
+	Environment string     `json:"environment,omitempty"`
+	// state-change-failed, the AWS error and its class
+	Error      string `json:"error,omitempty"`
+	ErrorCode  string `json:"errorCode,omitempty"`
+	ErrorClass string `json:"errorClass,omitempty"`
+
+	// human readable summary, the SNS subject
+	Subject string `json:"-"`
+}
+
+// notification of the instance for event, state is the new (or upcoming) state
+func (s *scheduler) newNotification(conf *lambdaConfig, event string, state lib.State, reason string, now time.Time) notification {
+	return notification{
+		Version:       notificationVersion,
+		Event:         event,
+		InstanceID:    s.instanceID,
+		InstanceName:  s.instanceName,
+		PreviousState: s.instanceState,
+		State:         state,
+		Reason:        reason,
+		Schedule:      s.schedule,
+		Timestamp:     now.UTC(),
+		Account:       s.accountID,
+		Region:        s.region,
+		Environment:   conf.Environment,
+	}
+}
+
+// instance reference in the logs, with its region when known
+func (n notification) logID() string {
+	if n.Region == "" {
+		return n.InstanceID
+	}
+	return n.Region + "/" + n.InstanceID
+}
+
+// message attributes of the notification, empty values are left out (SNS rejects them)
+func (n notification) attributes() map[string]snstypes.MessageAttributeValue {
+	attributes := map[string]snstypes.MessageAttributeValue{}
+	for name, value := range map[string]string{
+		"event":         n.Event,
+		"state":         string(n.State),
+		"previousState": string(n.PreviousState),
+		"account":       n.Account,
+		"region":        n.Region,
+		"environment":   n.Environment,
+		"errorClass":    n.ErrorClass,
+	} {
+		if value == "" {
+			continue
+		}
+		attributes[name] = snstypes.MessageAttributeValue{
+			DataType:    aws.String("String"),
+			StringValue: aws.String(value),
+		}
+	}
+
+	return attributes
+}
+
+// SNS subject: printable ASCII only, at most maxSubjectLength characters
+func subject(s string) string {
+	subject := strings.Map(func(r rune) rune {
+		if r < ' ' || r > '~' {
+			return '?'
+		}
+		return r
+	}, s)
+
+	if len(subject) > maxSubjectLength {
+		subject = subject[:maxSubjectLength-3] + "..."
+	}
+
+	return subject
+}
+
+// deliver the notification to every target of the instance
+func (s *scheduler) notify(ctx context.Context, notifiers *notifiers, n notification) error {
+	return notifiers.send(ctx, s.notifyTargets, n)
+}
+
+func (s *scheduler) publishStateChange(ctx context.Context, notifiers *notifiers, conf *lambdaConfig, stateChange lib.State, now time.Time) error {
+	n := s.newNotification(conf, eventStateChange, stateChange, s.reason, now)
+	n.Subject = fmt.Sprintf("%s (%s) state changed to %s", s.instanceID, s.instanceName, stateChange)
+
+	return s.notify(ctx, notifiers, n)
+}
+
+// EventBridge event of the instance, detailType is one of the lib.Event* constants
+func (s *scheduler) event(detailType string, now time.Time) lib.Event {
+	return lib.Event{
+		DetailType: detailType,
+		Detail: lib.EventDetail{
+			Type:         s.resourceType,
+			InstanceID:   s.instanceID,
+			InstanceName: s.instanceName,
+			Account:      s.accountID,
+			Region:       s.region,
+			Schedule:     s.schedule,
+		},
+		Time: now,
+	}
+}
+
+// InstanceStarted/InstanceStopped event of a state change
+func (s *scheduler) stateChangeEvent(stateChange lib.State, now time.Time) lib.Event {
+	detailType := lib.EventInstanceStarted
+	if stateChange == lib.StateStopped {
+		detailType = lib.EventInstanceStopped
+	}
+
+	event := s.event(detailType, now)
+	event.Detail.PreviousState = string(s.instanceState)
+	event.Detail.State = string(stateChange)
+	event.Detail.Reason = s.reason
+	return event
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/dwtechnologies/ec2scheduler/source/lib"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPublishStateChange(t *testing.T) {
+	conf := &lambdaConfig{Environment: "prod"}
+	client := &mockSNSclient{}
+	sch := &scheduler{
+		instanceID:    instanceID,
+		instanceName:  "web-1",
+		instanceState: lib.StateStopped,
+		accountID:     "123456789012",
+		region:        "eu-west-1",
+		schedule:      "07:00-19:00",
+		notifyTargets: []string{"arn:aws:sns:eu-west-1:123456789012:my-topic"},
+		reason:        "inside time window 07:00-19:00",
+	}
+	now := time.Date(2021, 01, 11, 7, 02, 00, 00, time.UTC)
+
+	err := sch.publishStateChange(context.Background(), &notifiers{sns: client}, conf, lib.StateRunning, now)
+	assert.NoError(t, err)
+	assert.Len(t, client.inputs, 1)
+
+	input := client.inputs[0]
+	assert.Equal(t, "arn:aws:sns:eu-west-1:123456789012:my-topic", aws.ToString(input.TopicArn))
+	assert.Equal(t, "i-07d023c826d243165 (web-1) state changed to running", aws.ToString(input.Subject))
+	assert.JSONEq(t, `{
+		"version": "1",
+		"event": "state-change",
+		"instanceId": "i-07d023c826d243165",
+		"instanceName": "web-1",
+		"previousState": "stopped",
+		"state": "running",
+		"reason": "inside time window 07:00-19:00",
+		"schedule": "07:00-19:00",
+		"timestamp": "2021-01-11T07:02:00Z",
+		"account": "123456789012",
+		"region": "eu-west-1",
+		"environment": "prod"
+	}`, aws.ToString(input.Message))
+
+	attributes := map[string]string{}
+	for name, value := range input.MessageAttributes {
+		assert.Equal(t, "String", aws.ToString(value.DataType))
+		attributes[name] = aws.ToString(value.StringValue)
+	}
+	assert.Equal(t, map[string]string{
+		"event":         "state-change",
+		"state":         "running",
+		"previousState": "stopped",
+		"account":       "123456789012",
+		"region":        "eu-west-1",
+		"environment":   "prod",
+	}, attributes)
+
+	// empty attributes are left out
+	_, ok := sch.newNotification(&lambdaConfig{}, eventStateChange, lib.StateRunning, "", now).attributes()["environment"]
+	assert.False(t, ok)
+
+	err = sch.publishStateChange(context.Background(), &notifiers{sns: &mockSNSclient{err: fmt.Errorf("error publishing")}}, conf, lib.StateRunning, now)
+	assert.Error(t, err)
+}
+
+func TestSubject(t *testing.T) {
+	assert.Equal(t, "i-1 (web-1) state changed to running", subject("i-1 (web-1) state changed to running"))
+	assert.Equal(t, "i-1 (caf?) state changed?to running", subject("i-1 (café) state changed\tto running"))
+
+	got := subject(strings.Repeat("a", 150))
+	assert.Len(t, got, maxSubjectLength)
+	assert.True(t, strings.HasSuffix(got, "..."))
+}
+
+func TestStateChangeEvent(t *testing.T) {
+	now := time.Date(2021, 01, 11, 19, 02, 00, 00, time.UTC)
+	sch := &scheduler{
+		instanceID:    instanceID,
+		instanceName:  "web-1",
+		instanceState: lib.StateRunning,
+		region:        "eu-west-1",
+		schedule:      "07:00-19:00",
+		reason:        "outside time windows",
+	}
+
+	assert.Equal(t, lib.Event{
+		DetailType: lib.EventInstanceStopped,
+		Detail: lib.EventDetail{
+			InstanceID:    instanceID,
+			InstanceName:  "web-1",
+			Region:        "eu-west-1",
+			Schedule:      "07:00-19:00",
+			PreviousState: "running",
+			State:         "stopped",
+			Reason:        "outside time windows",
+		},
+		Time: now,
+	}, sch.stateChangeEvent(lib.StateStopped, now))
+
+	assert.Equal(t, lib.EventInstanceStarted, sch.stateChangeEvent(lib.StateRunning, now).DetailType)
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"time"
+
+	"github.com/dwtechnologies/ec2scheduler/source/lib"
+)
+
+// the database runs again 7 days after the scheduler stopped it: AWS restarted it
+func (s *scheduler) restartedByAWS(now time.Time) bool {
+	if s.resourceType != lib.ResourceTypeDBInstance && s.resourceType != lib.ResourceTypeDBCluster {
+		return false
+	}
+
+	return s.instanceState == lib.StateRunning && !s.stoppedAt.IsZero() && now.Sub(s.stoppedAt) >= lib.RDSMaxStopped
+}
+
+// state to leave the resource in when the schedule doesn't decide (cron between fires, not active yet)
+// the current state, but stopped for a database AWS restarted: the scheduler stop still holds
+func (s *scheduler) keptState(now time.Time) lib.State {
+	if s.restartedByAWS(now) {
+		return lib.StateStopped
+	}
+
+	return s.instanceState
+}
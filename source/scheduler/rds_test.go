@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/caarlos0/env/v6"
+	"github.com/dwtechnologies/ec2scheduler/source/lib"
+	"github.com/dwtechnologies/ec2scheduler/source/lib/libtest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRestartedByAWS(t *testing.T) {
+	now := time.Date(2021, 01, 11, 20, 00, 00, 00, time.UTC)
+
+	tests := []struct {
+		name string
+		s    *scheduler
+		want bool
+	}{
+		{
+			name: "stopped 7 days ago, running",
+			s:    &scheduler{resourceType: lib.ResourceTypeDBInstance, instanceState: lib.StateRunning, stoppedAt: now.Add(-lib.RDSMaxStopped)},
+			want: true,
+		},
+		{
+			name: "stopped 2 days ago, running",
+			s:    &scheduler{resourceType: lib.ResourceTypeDBCluster, instanceState: lib.StateRunning, stoppedAt: now.Add(-48 * time.Hour)},
+		},
+		{
+			name: "still stopped",
+			s:    &scheduler{resourceType: lib.ResourceTypeDBInstance, instanceState: lib.StateStopped, stoppedAt: now.Add(-lib.RDSMaxStopped)},
+		},
+		{
+			name: "never stopped",
+			s:    &scheduler{resourceType: lib.ResourceTypeDBInstance, instanceState: lib.StateRunning},
+		},
+		{
+			name: "instance",
+			s:    &scheduler{resourceType: lib.ResourceTypeInstance, instanceState: lib.StateRunning, stoppedAt: now.Add(-lib.RDSMaxStopped)},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.want, test.s.restartedByAWS(now))
+		})
+	}
+}
+
+func TestScheduleRegionDBs(t *testing.T) {
+	conf := &lambdaConfig{}
+	assert.NoError(t, env.Parse(conf))
+	now := time.Date(2021, 01, 11, 10, 00, 00, 00, time.UTC) // Monday
+
+	// started and stopped once a month, AWS restarted it 7 days after the stop
+	rdsDriver := libtest.NewFakeDriver(lib.Resource{
+		Type:    lib.ResourceTypeDBInstance,
+		ID:      "reporting",
+		Name:    "reporting",
+		ARN:     "arn:aws:rds:eu-west-1:123456789012:db:reporting",
+		Account: "123456789012",
+		Region:  "eu-west-1",
+		State:   lib.StateRunning,
+		Tags: map[string]string{
+			"Schedule":          "start=0 7 1 * *;stop=0 19 2 * *",
+			"ScheduleStoppedAt": "2021-01-02T19:00:00Z",
+		},
+	})
+
+	result, events, err := scheduleRegion(context.Background(), conf, []lib.Driver{libtest.NewFakeDriver(), rdsDriver}, lib.NewCalendarStore(nil, nil, lib.CalendarConfig{}), &notifiers{}, "eu-west-1", false, now)
+	assert.NoError(t, err)
+
+	assert.Equal(t, lib.ResourceTypeDBInstance, result.Plan[0].Type)
+	assert.Equal(t, lib.StateStopped, result.Plan[0].ExpectedState)
+	assert.Equal(t, "no cron start or stop since the previous run, restarted by AWS after 7 days stopped", result.Plan[0].Reason)
+	assert.Equal(t, []string{"reporting"}, rdsDriver.Stopped)
+	assert.Equal(t, 1, result.Stopped)
+	assert.Len(t, events, 1)
+	assert.Equal(t, lib.EventInstanceStopped, events[0].DetailType)
+}